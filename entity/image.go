@@ -37,14 +37,15 @@ func NewImage(r io.Reader) *graphic.Mesh {
 
 	img, _, err := image.Decode(r)
 	if err != nil {
-		fmt.Println("Unsupported stride for image")
-		return graphic.NewMesh(geometry.NewPlane(1, 1), material.NewStandard(&math32.Color{R: 1, G: 1, B: 1}))
+		fmt.Println("Cannot decode image:", err)
+		return newImagePlaceholder()
 	}
 
 	// Converts image to RGBA format
 	rgba := image.NewRGBA(img.Bounds())
 	if rgba.Stride != rgba.Rect.Size().X*4 {
-		panic("unsupported stride")
+		fmt.Println("Unsupported stride for image")
+		return newImagePlaceholder()
 	}
 	draw.Draw(rgba, rgba.Bounds(), img, image.Point{0, 0}, draw.Src)
 
@@ -60,3 +61,8 @@ func NewImage(r io.Reader) *graphic.Mesh {
 	mesh.RotateX(math.Pi / 2.0)
 	return mesh
 }
+
+// newImagePlaceholder returns a white plane used if the image cannot be shown
+func newImagePlaceholder() *graphic.Mesh {
+	return graphic.NewMesh(geometry.NewPlane(1, 1), material.NewStandard(&math32.Color{R: 1, G: 1, B: 1}))
+}
@@ -0,0 +1,114 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package entity
+
+import (
+	"fmt"
+	"image"
+	"sync"
+
+	"github.com/g3n/engine/core"
+	"github.com/g3n/engine/geometry"
+	"github.com/g3n/engine/graphic"
+	"github.com/g3n/engine/gui/assets"
+	"github.com/g3n/engine/material"
+	"github.com/g3n/engine/math32"
+	"github.com/g3n/engine/text"
+	"github.com/g3n/engine/texture"
+	"github.com/roboticeyes/gorexfile/encoding/rexfile"
+)
+
+const (
+	labelFont          = "fonts/FreeSans.ttf"
+	labelPointSize     = 64  // resolution of the label texture
+	defaultLabelHeight = 0.2 // height in meters if the font size is not set
+)
+
+var (
+	labelFontOnce sync.Once
+	labelFontMu   sync.Mutex
+	labelFontData *text.Font
+)
+
+// Label shows the text of a REX text datablock. The text is drawn with a
+// built-in font to a texture which is shown either on a camera facing sprite
+// (billboard) or on a plane in world space. The label is placed at the
+// position of the datablock, its height is the font size in meters.
+type Label struct {
+	core.Node
+
+	Data    rexfile.Text
+	graphic graphic.IGraphic
+}
+
+// NewLabel creates the label for the REX text datablock. If billboard is false,
+// the text is drawn on a plane in the xy-plane which is visible from both sides.
+func NewLabel(block rexfile.Text, billboard bool) *Label {
+
+	l := &Label{Data: block}
+	l.Node.Init(l)
+	l.SetName(fmt.Sprintf("text-%d", block.ID))
+	l.SetPosition(block.Position.X(), block.Position.Y(), block.Position.Z())
+
+	alpha := block.Alpha
+	if alpha == 0 {
+		// older writers leave the alpha empty
+		alpha = 1
+	}
+	rgba := drawLabel(block.Text, &math32.Color4{R: block.Red, G: block.Green, B: block.Blue, A: alpha})
+
+	height := block.FontSize
+	if height <= 0 {
+		height = defaultLabelHeight
+	}
+	width := height
+	if size := rgba.Bounds().Size(); size.Y > 0 {
+		width = height * float32(size.X) / float32(size.Y)
+	}
+
+	// the basic material is unlit but ignores textures and alpha, the text
+	// therefore needs the standard material
+	mat := material.NewStandard(&math32.Color{R: 1, G: 1, B: 1})
+	mat.SetTransparent(true)
+	mat.AddTexture(texture.NewTexture2DFromRGBA(rgba))
+
+	if billboard {
+		l.graphic = graphic.NewSprite(width, height, mat)
+	} else {
+		mat.SetSide(material.SideDouble)
+		l.graphic = graphic.NewMesh(geometry.NewPlane(width, height), mat)
+	}
+	l.Add(l.graphic)
+	return l
+}
+
+// Graphic returns the sprite or plane showing the text
+func (l *Label) Graphic() graphic.IGraphic {
+	return l.graphic
+}
+
+// drawLabel draws the text with a transparent background
+func drawLabel(s string, color *math32.Color4) *image.RGBA {
+
+	labelFontOnce.Do(func() {
+		font, err := text.NewFontFromData(assets.MustAsset(labelFont))
+		if err != nil {
+			panic(err)
+		}
+		font.SetPointSize(labelPointSize)
+		font.SetBgColor(&math32.Color4{})
+		labelFontData = font
+	})
+
+	// the font keeps the color, therefore it is used by one goroutine at a time
+	labelFontMu.Lock()
+	defer labelFontMu.Unlock()
+	labelFontData.SetFgColor(color)
+	if s == "" {
+		// keep a valid texture size
+		s = " "
+	}
+	return labelFontData.DrawText(s)
+}
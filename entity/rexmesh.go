@@ -1,21 +1,16 @@
 package entity
 
 import (
-	"bytes"
 	"fmt"
-	"image"
-	"image/draw"
-	_ "image/jpeg" // support jpeg
-	_ "image/png"  // support png
 	"math/rand"
 
 	"github.com/breiting/g3next/geom"
 	"github.com/breiting/g3next/mat"
+	"github.com/g3n/engine/geometry"
 	"github.com/g3n/engine/gls"
 	"github.com/g3n/engine/graphic"
 	"github.com/g3n/engine/material"
 	"github.com/g3n/engine/math32"
-	"github.com/g3n/engine/texture"
 	"github.com/roboticeyes/gorexfile/encoding/rexfile"
 )
 
@@ -28,15 +23,20 @@ type RexMesh struct {
 
 	data     rexfile.Mesh
 	material rexfile.Material
-	phong    *material.Standard
+	phong    *mat.RexStandardMaterial
 }
 
 func NewRexMesh(data rexfile.Mesh) *RexMesh {
+	return NewRexMeshFromGeometry(data, geom.NewRexMeshGeometry(data))
+}
+
+// NewRexMeshFromGeometry creates the mesh with a geometry which has already
+// been built from the datablock with geom.NewRexMeshGeometry
+func NewRexMeshFromGeometry(data rexfile.Mesh, geom *geometry.Geometry) *RexMesh {
 
 	mesh := &RexMesh{
 		data: data,
 	}
-	geom := geom.NewRexMeshGeometry(data)
 
 	// select material based on vertex coloring
 	if geom.VBO(gls.VertexColor) != nil {
@@ -58,23 +58,52 @@ func NewRexMesh(data rexfile.Mesh) *RexMesh {
 	return mesh
 }
 
+// ID returns the ID of the REX mesh datablock
+func (m *RexMesh) ID() uint64 {
+	return m.data.ID
+}
+
+// MaterialID returns the ID of the material referenced by the REX mesh datablock
+func (m *RexMesh) MaterialID() uint64 {
+	return m.data.MaterialID
+}
+
 // OfferMaterial is used by the caller to propagate a material. If the
 // materialID is matching, the material is replaced
 func (m *RexMesh) OfferMaterial(material rexfile.Material) {
 
-	if material.ID != m.data.MaterialID {
+	if !m.acceptMaterial(material) {
+		return
+	}
+	m.setMaterial(mat.NewRexStandardMaterial(material), material)
+}
+
+// ApplyMaterial is like OfferMaterial but takes the material from the cache,
+// so that all meshes with the same material share it
+func (m *RexMesh) ApplyMaterial(cache *mat.Cache, material rexfile.Material) {
+
+	if !m.acceptMaterial(material) {
 		return
 	}
+	m.setMaterial(cache.Material(material), material)
+}
+
+func (m *RexMesh) acceptMaterial(material rexfile.Material) bool {
+
+	if material.ID != m.data.MaterialID {
+		return false
+	}
 
 	// Ignore StandardMaterial if VertexColor is available
 	if m.Graphic.GetGeometry().VBO(gls.VertexColor) != nil {
 		fmt.Printf("Ignoring Material since vertex colors are available (mesh: %d)\n", m.data.ID)
-		return
-		// } else {
-		// 	fmt.Printf("Set material %d for mesh %d\n", material.ID, m.data.ID)
+		return false
 	}
+	return true
+}
 
-	m.phong = mat.NewRexStandardMaterial(material)
+func (m *RexMesh) setMaterial(phong *mat.RexStandardMaterial, material rexfile.Material) {
+	m.phong = phong
 	m.Graphic.ClearMaterials()
 	m.Graphic.AddMaterial(m, m.phong, 0, 0)
 	m.material = material
@@ -88,26 +117,25 @@ func (m *RexMesh) OfferTexture(img rexfile.Image) {
 		return
 	}
 
-	if m.phong == nil {
+	if m.phong == nil || m.phong.Texture != nil {
 		return
 	}
 
-	decodedImg, _, err := image.Decode(bytes.NewReader(img.Data))
+	tex, err := mat.NewRexTexture(img)
 	if err != nil {
-		fmt.Println("Cannot decode texture", img.ID)
+		fmt.Println(err)
 		return
 	}
+	m.phong.AddTexture(tex)
+	m.phong.Texture = &img
+}
 
-	// Converts image to RGBA format
-	rgba := image.NewRGBA(decodedImg.Bounds())
-	if rgba.Stride != rgba.Rect.Size().X*4 {
-		fmt.Println("Unsupported stride information for texture", img.ID)
-		return
-	}
-	draw.Draw(rgba, rgba.Bounds(), decodedImg, image.Point{0, 0}, draw.Src)
+// Instance returns a new mesh which shares the geometry and the material of
+// this mesh. The reference counts are incremented, so that disposing an
+// instance does not release the resources of the others.
+func (m *RexMesh) Instance() *graphic.Mesh {
 
-	tex := texture.NewTexture2DFromRGBA(rgba)
-	tex.SetWrapS(gls.REPEAT)
-	tex.SetWrapT(gls.REPEAT)
-	m.phong.AddTexture(tex)
+	imat := m.GetMaterial(0)
+	imat.GetMaterial().Incref()
+	return graphic.NewMesh(m.GetGeometry().Incref(), imat)
 }
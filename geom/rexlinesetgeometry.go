@@ -8,15 +8,25 @@ import (
 	"github.com/g3n/engine/geometry"
 	"github.com/g3n/engine/gls"
 	"github.com/g3n/engine/math32"
+	"github.com/go-gl/mathgl/mgl32"
 	"github.com/roboticeyes/gorexfile/encoding/rexfile"
 )
 
-// NewRexLineSetGeometry returns a new geometry information for the given REX lineset datablock
+// NewRexLineSetGeometry returns a new geometry information for the given REX lineset datablock.
+// All vertices get the color of the lineset.
 func NewRexLineSetGeometry(points rexfile.LineSet) *geometry.Geometry {
+	return NewRexLineSetGeometryColors(points, nil)
+}
+
+// NewRexLineSetGeometryColors is like NewRexLineSetGeometry but uses the given colors per
+// vertex. If the number of colors does not match the number of points, the color of the
+// lineset is used instead.
+func NewRexLineSetGeometryColors(points rexfile.LineSet, vertexColors []mgl32.Vec3) *geometry.Geometry {
 
 	geom := new(geometry.Geometry)
 
 	positions := math32.NewArrayF32(len(points.Points)*3, len(points.Points)*3)
+	colors := math32.NewArrayF32(len(points.Points)*3, len(points.Points)*3)
 
 	j := 0
 	for _, c := range points.Points {
@@ -26,6 +36,20 @@ func NewRexLineSetGeometry(points rexfile.LineSet) *geometry.Geometry {
 		}
 	}
 
+	useVertexColors := len(vertexColors) == len(points.Points)
+	j = 0
+	for k := range points.Points {
+		c := points.Colors.Vec3()
+		if useVertexColors {
+			c = vertexColors[k]
+		}
+		for i := 0; i < 3; i++ {
+			colors[j] = c[i]
+			j++
+		}
+	}
+
 	geom.AddVBO(gls.NewVBO(positions).AddAttrib(gls.VertexPosition))
+	geom.AddVBO(gls.NewVBO(colors).AddAttrib(gls.VertexColor))
 	return geom
 }
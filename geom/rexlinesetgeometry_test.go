@@ -0,0 +1,49 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geom
+
+import (
+	"testing"
+
+	"github.com/g3n/engine/gls"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/roboticeyes/gorexfile/encoding/rexfile"
+)
+
+func TestRexLineSetGeometryColors(t *testing.T) {
+
+	ls := rexfile.LineSet{
+		Colors: mgl32.Vec4{0.25, 0.5, 1, 1},
+		Points: []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}},
+	}
+	red, green, blue := mgl32.Vec3{1, 0, 0}, mgl32.Vec3{0, 1, 0}, mgl32.Vec3{0, 0, 1}
+	set := ls.Colors.Vec3()
+
+	tests := []struct {
+		name         string
+		vertexColors []mgl32.Vec3
+		want         []mgl32.Vec3
+	}{
+		{"lineset color", nil, []mgl32.Vec3{set, set, set}},
+		{"vertex colors", []mgl32.Vec3{red, green, blue}, []mgl32.Vec3{red, green, blue}},
+		{"too few vertex colors", []mgl32.Vec3{red, green}, []mgl32.Vec3{set, set, set}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			g := NewRexLineSetGeometryColors(ls, tt.vertexColors)
+			colors := *g.VBO(gls.VertexColor).Buffer()
+			if len(colors) != 3*len(tt.want) {
+				t.Fatalf("%d color values, want %d", len(colors), 3*len(tt.want))
+			}
+			for i, want := range tt.want {
+				if got := (mgl32.Vec3{colors[3*i], colors[3*i+1], colors[3*i+2]}); got != want {
+					t.Errorf("vertex %d has the color %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
@@ -11,7 +11,9 @@ import (
 	"github.com/roboticeyes/gorexfile/encoding/rexfile"
 )
 
-// NewRexMeshGeometry returns a new geometry information for the given REX mesh datablock
+// NewRexMeshGeometry returns a new geometry information for the given REX mesh datablock.
+// Triangles referencing vertices out of range are dropped, colors and texture coordinates
+// are only used if their count matches the number of vertices.
 func NewRexMeshGeometry(mesh rexfile.Mesh) *geometry.Geometry {
 
 	geom := new(geometry.Geometry)
@@ -20,7 +22,7 @@ func NewRexMeshGeometry(mesh rexfile.Mesh) *geometry.Geometry {
 	colors := math32.NewArrayF32(len(mesh.Colors)*3, len(mesh.Colors)*3)
 	uvs := math32.NewArrayF32(len(mesh.TexCoords)*2, len(mesh.TexCoords)*2)
 	normals := math32.NewArrayF32(len(mesh.Coords)*3, len(mesh.Coords)*3)
-	indices := math32.NewArrayU32(len(mesh.Triangles)*3, len(mesh.Triangles)*3)
+	indices := math32.NewArrayU32(0, len(mesh.Triangles)*3)
 	tempNormals := make([][]math32.Vector3, len(mesh.Coords))
 
 	j := 0
@@ -47,12 +49,12 @@ func NewRexMeshGeometry(mesh rexfile.Mesh) *geometry.Geometry {
 		}
 	}
 
-	j = 0
+	nrCoords := uint32(len(mesh.Coords))
 	for _, t := range mesh.Triangles {
-		indices[j] = t.V0
-		indices[j+1] = t.V1
-		indices[j+2] = t.V2
-		j += 3
+		if t.V0 >= nrCoords || t.V1 >= nrCoords || t.V2 >= nrCoords {
+			continue
+		}
+		indices.Append(t.V0, t.V1, t.V2)
 
 		// calculate normals per face
 		var v0, v1, v2 math32.Vector3
@@ -81,10 +83,13 @@ func NewRexMeshGeometry(mesh rexfile.Mesh) *geometry.Geometry {
 
 	geom.SetIndices(indices)
 	geom.AddVBO(gls.NewVBO(positions).AddAttrib(gls.VertexPosition))
-	if len(colors) > 0 {
+	if len(colors) > 0 && len(mesh.Colors) == len(mesh.Coords) {
 		geom.AddVBO(gls.NewVBO(colors).AddAttrib(gls.VertexColor))
 	}
 	geom.AddVBO(gls.NewVBO(normals).AddAttrib(gls.VertexNormal))
+	if len(mesh.TexCoords) != len(mesh.Coords) {
+		uvs = math32.NewArrayF32(0, 0)
+	}
 	geom.AddVBO(gls.NewVBO(uvs).AddAttrib(gls.VertexTexcoord))
 
 	return geom
@@ -0,0 +1,268 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geom
+
+import (
+	"math"
+	"sort"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+const epsilon = 1e-12
+
+// CleanRing removes the closing point and repeated points. The ring is
+// returned counter-clockwise if ccw is set, clockwise otherwise. Rings with
+// less than three points or without area return nil.
+func CleanRing(ring []mgl64.Vec3, ccw bool) []mgl64.Vec3 {
+
+	var out []mgl64.Vec3
+	for _, p := range ring {
+		if len(out) > 0 && samePoint(out[len(out)-1], p) {
+			continue
+		}
+		out = append(out, p)
+	}
+	for len(out) > 1 && samePoint(out[0], out[len(out)-1]) {
+		out = out[:len(out)-1]
+	}
+	if len(out) < 3 {
+		return nil
+	}
+
+	area := signedArea(out)
+	if math.Abs(area) < epsilon {
+		return nil
+	}
+	if (area > 0) != ccw {
+		for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+			out[i], out[j] = out[j], out[i]
+		}
+	}
+	return out
+}
+
+// Triangulate triangulates the polygon in the xy plane by ear clipping. The
+// outer ring must be counter-clockwise and the holes clockwise (see
+// CleanRing). The returned indices refer to the points of all rings in order.
+func Triangulate(outer []mgl64.Vec3, holes [][]mgl64.Vec3) [][3]int {
+
+	var points []mgl64.Vec3
+	ring := func(r []mgl64.Vec3) []int {
+		idx := make([]int, len(r))
+		for i, p := range r {
+			idx[i] = len(points)
+			points = append(points, p)
+		}
+		return idx
+	}
+
+	poly := ring(outer)
+	var holeIdx [][]int
+	for _, h := range holes {
+		holeIdx = append(holeIdx, ring(h))
+	}
+
+	// holes are connected to the outer ring by a bridge, starting with the
+	// hole reaching furthest to the right
+	sort.Slice(holeIdx, func(i, j int) bool {
+		return points[holeIdx[i][rightmost(points, holeIdx[i])]].X() > points[holeIdx[j][rightmost(points, holeIdx[j])]].X()
+	})
+	for i, h := range holeIdx {
+		poly = bridge(points, poly, h, holeIdx[i+1:])
+	}
+
+	return earClip(points, poly)
+}
+
+// TriangulatePolygon triangulates a planar polygon in space, e.g. a face with
+// more than three corners, by ear clipping. The polygon is projected onto the
+// plane of its Newell normal, the triangles keep its orientation. The returned
+// indices refer to the corners. Polygons without area are triangulated as fan.
+func TriangulatePolygon(corners []mgl32.Vec3) [][3]int {
+
+	var n mgl64.Vec3
+	for i, p := range corners {
+		q := corners[(i+1)%len(corners)]
+		n[0] += float64((p.Y() - q.Y()) * (p.Z() + q.Z()))
+		n[1] += float64((p.Z() - q.Z()) * (p.X() + q.X()))
+		n[2] += float64((p.X() - q.X()) * (p.Y() + q.Y()))
+	}
+	if n.Len() < epsilon {
+		var triangles [][3]int
+		for i := 1; i+1 < len(corners); i++ {
+			triangles = append(triangles, [3]int{0, i, i + 1})
+		}
+		return triangles
+	}
+
+	// u and v span the plane with u x v = n, the polygon is counter-clockwise
+	n = n.Normalize()
+	axis := mgl64.Vec3{1, 0, 0}
+	if math.Abs(n.X()) > 0.9 {
+		axis = mgl64.Vec3{0, 1, 0}
+	}
+	u := n.Cross(axis).Normalize()
+	v := n.Cross(u)
+
+	points := make([]mgl64.Vec3, len(corners))
+	poly := make([]int, len(corners))
+	for i, c := range corners {
+		p := mgl64.Vec3{float64(c.X()), float64(c.Y()), float64(c.Z())}
+		points[i] = mgl64.Vec3{p.Dot(u), p.Dot(v), 0}
+		poly[i] = i
+	}
+	return earClip(points, poly)
+}
+
+// rightmost returns the position of the point with the largest x in the ring
+func rightmost(points []mgl64.Vec3, ring []int) int {
+	best := 0
+	for i, idx := range ring {
+		if points[idx].X() > points[ring[best]].X() {
+			best = i
+		}
+	}
+	return best
+}
+
+// bridge merges the hole into the polygon by connecting the rightmost point
+// of the hole with the closest polygon point which can be seen from it
+func bridge(points []mgl64.Vec3, poly, hole []int, others [][]int) []int {
+
+	start := rightmost(points, hole)
+	h := points[hole[start]]
+
+	edges := [][]int{poly, hole}
+	edges = append(edges, others...)
+
+	best, bestDist := -1, math.MaxFloat64
+	for i, idx := range poly {
+		p := points[idx]
+		d := p.Sub(h).Len()
+		if d >= bestDist {
+			continue
+		}
+		if !visible(points, edges, h, p) {
+			continue
+		}
+		best, bestDist = i, d
+	}
+	if best < 0 {
+		// no visible point, e.g. for a hole crossing the outer ring
+		return poly
+	}
+
+	merged := make([]int, 0, len(poly)+len(hole)+2)
+	merged = append(merged, poly[:best+1]...)
+	for k := 0; k <= len(hole); k++ {
+		merged = append(merged, hole[(start+k)%len(hole)])
+	}
+	merged = append(merged, poly[best:]...)
+	return merged
+}
+
+// visible reports whether the segment a-b crosses none of the ring edges
+func visible(points []mgl64.Vec3, rings [][]int, a, b mgl64.Vec3) bool {
+	for _, ring := range rings {
+		for i := range ring {
+			p, q := points[ring[i]], points[ring[(i+1)%len(ring)]]
+			if samePoint(p, a) || samePoint(p, b) || samePoint(q, a) || samePoint(q, b) {
+				continue
+			}
+			if segmentsIntersect(a, b, p, q) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// earClip triangulates the counter-clockwise polygon given by the indices
+func earClip(points []mgl64.Vec3, poly []int) [][3]int {
+
+	var triangles [][3]int
+	remaining := append([]int(nil), poly...)
+
+	for len(remaining) > 3 {
+		found := false
+		for i := range remaining {
+			prev := remaining[(i+len(remaining)-1)%len(remaining)]
+			cur := remaining[i]
+			next := remaining[(i+1)%len(remaining)]
+			if !isEar(points, remaining, prev, cur, next) {
+				continue
+			}
+			triangles = append(triangles, [3]int{prev, cur, next})
+			remaining = append(remaining[:i], remaining[i+1:]...)
+			found = true
+			break
+		}
+		if !found {
+			// degenerate or self-intersecting polygon, clip the next convex corner
+			clipped := false
+			for i := range remaining {
+				prev := remaining[(i+len(remaining)-1)%len(remaining)]
+				next := remaining[(i+1)%len(remaining)]
+				if cross(points[prev], points[remaining[i]], points[next]) > 0 {
+					triangles = append(triangles, [3]int{prev, remaining[i], next})
+					remaining = append(remaining[:i], remaining[i+1:]...)
+					clipped = true
+					break
+				}
+			}
+			if !clipped {
+				return triangles
+			}
+		}
+	}
+	if len(remaining) == 3 && cross(points[remaining[0]], points[remaining[1]], points[remaining[2]]) > epsilon {
+		triangles = append(triangles, [3]int{remaining[0], remaining[1], remaining[2]})
+	}
+	return triangles
+}
+
+func isEar(points []mgl64.Vec3, poly []int, prev, cur, next int) bool {
+
+	a, b, c := points[prev], points[cur], points[next]
+	if cross(a, b, c) <= epsilon {
+		return false
+	}
+	for _, idx := range poly {
+		p := points[idx]
+		if samePoint(p, a) || samePoint(p, b) || samePoint(p, c) {
+			continue
+		}
+		if cross(a, b, p) >= 0 && cross(b, c, p) >= 0 && cross(c, a, p) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// cross is the z component of (b-a)x(c-a), positive for a left turn
+func cross(a, b, c mgl64.Vec3) float64 {
+	return (b.X()-a.X())*(c.Y()-a.Y()) - (b.Y()-a.Y())*(c.X()-a.X())
+}
+
+func signedArea(ring []mgl64.Vec3) float64 {
+	var area float64
+	for i, p := range ring {
+		q := ring[(i+1)%len(ring)]
+		area += p.X()*q.Y() - q.X()*p.Y()
+	}
+	return area / 2
+}
+
+func segmentsIntersect(a, b, p, q mgl64.Vec3) bool {
+	d1, d2 := cross(p, q, a), cross(p, q, b)
+	d3, d4 := cross(a, b, p), cross(a, b, q)
+	return ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) && ((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0))
+}
+
+func samePoint(a, b mgl64.Vec3) bool {
+	return math.Abs(a.X()-b.X()) < 1e-9 && math.Abs(a.Y()-b.Y()) < 1e-9
+}
@@ -0,0 +1,156 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geom
+
+import (
+	"math"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+// lShape is a concave polygon in the xy plane with an area of 3, a fan
+// around the first corner would overlap
+var lShape = []mgl32.Vec3{{2, 1, 0}, {1, 1, 0}, {1, 2, 0}, {0, 2, 0}, {0, 0, 0}, {2, 0, 0}}
+
+// tilt rotates the points out of the xy plane
+func tilt(points []mgl32.Vec3) []mgl32.Vec3 {
+	q := mgl32.QuatRotate(0.7, mgl32.Vec3{1, 1, 0}.Normalize())
+	r := make([]mgl32.Vec3, len(points))
+	for i, p := range points {
+		r[i] = q.Rotate(p)
+	}
+	return r
+}
+
+func reverse(points []mgl32.Vec3) []mgl32.Vec3 {
+	r := make([]mgl32.Vec3, len(points))
+	for i, p := range points {
+		r[len(points)-1-i] = p
+	}
+	return r
+}
+
+func TestTriangulatePolygon(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		corners   []mgl32.Vec3
+		triangles int
+		area      float32
+		normal    mgl32.Vec3 // of all triangles
+	}{
+		{
+			name:      "square",
+			corners:   []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {0, 1, 0}},
+			triangles: 2,
+			area:      1,
+			normal:    mgl32.Vec3{0, 0, 1},
+		},
+		{
+			name:      "concave",
+			corners:   lShape,
+			triangles: 4,
+			area:      3,
+			normal:    mgl32.Vec3{0, 0, 1},
+		},
+		{
+			name:      "concave clockwise",
+			corners:   reverse(lShape),
+			triangles: 4,
+			area:      3,
+			normal:    mgl32.Vec3{0, 0, -1},
+		},
+		{
+			name:      "concave tilted",
+			corners:   tilt(lShape),
+			triangles: 4,
+			area:      3,
+			normal:    tilt([]mgl32.Vec3{{0, 0, 1}})[0],
+		},
+		{
+			name:      "collinear corner",
+			corners:   []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {2, 0, 0}, {2, 0, 1}, {0, 0, 1}},
+			triangles: 3,
+			area:      2,
+			normal:    mgl32.Vec3{0, -1, 0},
+		},
+		{
+			name:      "without area",
+			corners:   []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {2, 0, 0}, {3, 0, 0}},
+			triangles: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			triangles := TriangulatePolygon(tt.corners)
+			if len(triangles) != tt.triangles {
+				t.Fatalf("%d triangles, want %d", len(triangles), tt.triangles)
+			}
+			var area float32
+			for _, tri := range triangles {
+				a, b, c := tt.corners[tri[0]], tt.corners[tri[1]], tt.corners[tri[2]]
+				n := b.Sub(a).Cross(c.Sub(a))
+				area += n.Len() / 2
+				if n.Len() > 1e-6 && !n.Normalize().ApproxEqualThreshold(tt.normal, 1e-4) {
+					t.Errorf("triangle %v has normal %v, want %v", tri, n.Normalize(), tt.normal)
+				}
+			}
+			if math.Abs(float64(area-tt.area)) > 1e-4 {
+				t.Errorf("area is %v, want %v", area, tt.area)
+			}
+		})
+	}
+}
+
+func TestTriangulate(t *testing.T) {
+
+	square := func(x, y, size float64) []mgl64.Vec3 {
+		return []mgl64.Vec3{{x, y, 0}, {x + size, y, 0}, {x + size, y + size, 0}, {x, y + size, 0}}
+	}
+
+	tests := []struct {
+		name  string
+		outer []mgl64.Vec3
+		holes [][]mgl64.Vec3
+		area  float64
+	}{
+		{"square", square(0, 0, 4), nil, 16},
+		{"closed clockwise ring", append(square(0, 0, 4), mgl64.Vec3{0, 0, 0}), nil, 16},
+		{"hole", square(0, 0, 4), [][]mgl64.Vec3{square(1, 1, 2)}, 12},
+		{"two holes", square(0, 0, 4), [][]mgl64.Vec3{square(0.5, 0.5, 1), square(2.5, 2.5, 1)}, 14},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			outer := CleanRing(tt.outer, true)
+			var holes [][]mgl64.Vec3
+			for _, h := range tt.holes {
+				holes = append(holes, CleanRing(h, false))
+			}
+			var points []mgl64.Vec3
+			points = append(points, outer...)
+			for _, h := range holes {
+				points = append(points, h...)
+			}
+
+			var area float64
+			for _, tri := range Triangulate(outer, holes) {
+				a := cross(points[tri[0]], points[tri[1]], points[tri[2]]) / 2
+				if a < 0 {
+					t.Errorf("triangle %v is clockwise", tri)
+				}
+				area += a
+			}
+			if math.Abs(area-tt.area) > 1e-9 {
+				t.Errorf("area is %v, want %v", area, tt.area)
+			}
+		})
+	}
+}
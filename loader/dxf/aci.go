@@ -0,0 +1,79 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dxf
+
+import (
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// ACI color numbers with a special meaning
+const (
+	ByBlock = 0
+	ByLayer = 256
+	white   = 7
+)
+
+var standardColors = map[int]mgl32.Vec3{
+	1: {1, 0, 0},
+	2: {1, 1, 0},
+	3: {0, 1, 0},
+	4: {0, 1, 1},
+	5: {0, 0, 1},
+	6: {1, 0, 1},
+	7: {1, 1, 1},
+	8: {0.5, 0.5, 0.5},
+	9: {0.75, 0.75, 0.75},
+}
+
+var grays = []float32{0.2, 0.31, 0.41, 0.51, 0.75, 1}
+
+// ACIColor returns the RGB value of an AutoCAD color index. The colors 10 to
+// 249 are generated from 24 hues with five brightness levels, each as full
+// and as pale color, which approximates the AutoCAD palette.
+func ACIColor(aci int) mgl32.Vec3 {
+
+	if c, ok := standardColors[aci]; ok {
+		return c
+	}
+	if aci >= 250 && aci <= 255 {
+		g := grays[aci-250]
+		return mgl32.Vec3{g, g, g}
+	}
+	if aci < 10 || aci > 249 {
+		return standardColors[white]
+	}
+
+	hue := float64((aci-10)/10) * 15
+	variant := aci % 10
+	value := []float32{1, 0.65, 0.5, 0.3, 0.15}[variant/2]
+
+	var c mgl32.Vec3
+	for i, offset := range []float64{0, 120, 240} {
+		// distance of the hue to the primary color of the channel
+		d := math.Mod(hue-offset+360, 360)
+		if d > 180 {
+			d = 360 - d
+		}
+		c[i] = float32(math.Max(0, math.Min(1, 2-d/60)))
+	}
+	for i := range c {
+		if variant%2 == 1 {
+			c[i] = 0.5 + 0.5*c[i]
+		}
+		c[i] *= value
+	}
+	return c
+}
+
+// trueColor converts the 24 bit color of group code 420
+func trueColor(rgb int) mgl32.Vec3 {
+	return mgl32.Vec3{
+		float32(rgb>>16&0xff) / 255,
+		float32(rgb>>8&0xff) / 255,
+		float32(rgb&0xff) / 255,
+	}
+}
@@ -0,0 +1,472 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package dxf imports the entities of ASCII DXF files. Every layer becomes a
+// group with the layer attached as user data (see LayerOf). Lines,
+// polylines, circles and arcs are loaded as line sets, 3D faces and polyface
+// meshes as meshes and texts as labels. Blocks and their inserts are not
+// supported.
+package dxf
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/breiting/g3next/loader/rex"
+	"github.com/g3n/engine/core"
+	"github.com/g3n/engine/graphic"
+	"github.com/g3n/engine/material"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/roboticeyes/gorexfile/encoding/rexfile"
+)
+
+// defaultSegments is the number of segments of a full circle
+const defaultSegments = 64
+
+// meters per drawing unit by the $INSUNITS header variable
+var unitScale = map[int]float64{
+	1:  0.0254,
+	2:  0.3048,
+	3:  1609.344,
+	4:  0.001,
+	5:  0.01,
+	6:  1,
+	7:  1000,
+	10: 0.9144,
+	14: 0.1,
+}
+
+// Options control how the DXF content is converted
+type Options struct {
+	rex.LoadOptions
+
+	// Scale converts drawing units into meters. If 0, the scale is taken
+	// from the $INSUNITS header variable, drawings without units are not
+	// scaled. The origin of LoadOptions is given in meters.
+	Scale float64
+
+	// Segments is the number of line segments of a full circle, 64 if 0
+	Segments int
+}
+
+// Layer is attached as user data to the group of every layer
+type Layer struct {
+	Name  string
+	Color int // ACI color number of the layer
+}
+
+// LayerOf returns the layer of the node or of its closest parent
+func LayerOf(inode core.INode) (*Layer, bool) {
+
+	for inode != nil {
+		if l, ok := inode.GetNode().UserData().(*Layer); ok {
+			return l, true
+		}
+		inode = inode.GetNode().Parent()
+	}
+	return nil, false
+}
+
+// pair is a group code with its value
+type pair struct {
+	code  int
+	value string
+}
+
+// entity is a sequence of group codes starting with its type (code 0)
+type entity struct {
+	typ   string
+	pairs []pair
+}
+
+func (e *entity) str(code int) string {
+	for _, p := range e.pairs {
+		if p.code == code {
+			return p.value
+		}
+	}
+	return ""
+}
+
+func (e *entity) float(code int, def float64) float64 {
+	for _, p := range e.pairs {
+		if p.code == code {
+			if f, err := strconv.ParseFloat(p.value, 64); err == nil {
+				return f
+			}
+		}
+	}
+	return def
+}
+
+func (e *entity) int(code int, def int) int {
+	return int(e.float(code, float64(def)))
+}
+
+// point returns the point given by the codes x, x+10 and x+20
+func (e *entity) point(code int) mgl64.Vec3 {
+	return mgl64.Vec3{e.float(code, 0), e.float(code+10, 0), e.float(code+20, 0)}
+}
+
+// extrusion returns the normal of the object coordinate system
+func (e *entity) extrusion() mgl64.Vec3 {
+	return mgl64.Vec3{e.float(210, 0), e.float(220, 0), e.float(230, 1)}
+}
+
+// Decoder is the DXF file decoder
+type Decoder struct {
+	r    io.Reader
+	opts Options
+}
+
+// NewDecoder reads the DXF file
+func NewDecoder(dxfFile string) (*Decoder, error) {
+
+	data, err := ioutil.ReadFile(dxfFile)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot open file %s", dxfFile)
+	}
+	return &Decoder{r: bytes.NewReader(data)}, nil
+}
+
+// NewDecoderReader creates a decoder with a reader
+func NewDecoderReader(r io.Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+// SetOptions sets the options used for building the scene graph
+func (dec *Decoder) SetOptions(opts Options) {
+	dec.opts = opts
+}
+
+// NewGroup decodes the DXF file and returns a group with a child group per
+// layer containing entities
+func (dec *Decoder) NewGroup(name string) (*core.Node, error) {
+
+	d, err := parse(dec.r)
+	if err != nil {
+		return nil, err
+	}
+
+	b := newBuilder(d, dec.opts)
+	for _, e := range d.entities {
+		b.add(e)
+	}
+
+	// the coordinates are already local, all lines are stored as segments
+	opts := dec.opts.LoadOptions
+	opts.Origin = nil
+	opts.LocalOrigin = false
+	opts.LineMode = rex.LineSegments
+
+	group := core.NewNode()
+	group.SetName(name)
+	for _, l := range b.order {
+		lg, _, err := rex.CreateRexNodeOptions(l.file, l.name, opts)
+		if err != nil {
+			return nil, err
+		}
+		lg.SetUserData(&Layer{Name: l.name, Color: d.layers[l.name]})
+		// DXF faces have no front side
+		for _, child := range lg.Children() {
+			if g, ok := child.(graphic.IGraphic); ok && rex.ToMesh(child) != nil {
+				g.GetGraphic().GetMaterial(0).GetMaterial().SetSide(material.SideDouble)
+			}
+		}
+		group.Add(lg)
+	}
+	if b.hasOrigin {
+		group.SetUserData(&rex.Georeference{Origin: b.origin})
+	}
+	return group, nil
+}
+
+// drawing is the parsed content of the DXF file
+type drawing struct {
+	units    int
+	layers   map[string]int // ACI color by layer name
+	entities []entity
+}
+
+// parse reads the group codes of the HEADER, TABLES and ENTITIES sections
+func parse(r io.Reader) (*drawing, error) {
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var pairs []pair
+	for line := 1; scanner.Scan(); line += 2 {
+		code, err := strconv.Atoi(strings.TrimSpace(scanner.Text()))
+		if err != nil {
+			return nil, fmt.Errorf("Cannot read DXF line %d: invalid group code", line)
+		}
+		if !scanner.Scan() {
+			return nil, fmt.Errorf("Cannot read DXF line %d: missing value", line+1)
+		}
+		value := strings.TrimRight(scanner.Text(), "\r")
+		if code != 1 {
+			value = strings.TrimSpace(value)
+		}
+		pairs = append(pairs, pair{code: code, value: value})
+		if code == 0 && value == "EOF" {
+			// anything after the end of file, e.g. blank lines, is ignored
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Cannot read DXF file: %v", err)
+	}
+
+	d := &drawing{layers: make(map[string]int)}
+	var section string
+	for i := 0; i < len(pairs); i++ {
+		p := pairs[i]
+		if p.code != 0 {
+			continue
+		}
+		switch {
+		case p.value == "SECTION" && i+1 < len(pairs) && pairs[i+1].code == 2:
+			section = pairs[i+1].value
+			i++
+			if section == "HEADER" {
+				var header entity
+				for i+1 < len(pairs) && pairs[i+1].code != 0 {
+					i++
+					header.pairs = append(header.pairs, pairs[i])
+				}
+				parseHeader(d, header)
+			}
+			continue
+		case p.value == "ENDSEC":
+			section = ""
+			continue
+		}
+
+		// collect the group codes up to the next entity
+		e := entity{typ: p.value}
+		for i+1 < len(pairs) && pairs[i+1].code != 0 {
+			i++
+			e.pairs = append(e.pairs, pairs[i])
+		}
+
+		switch section {
+		case "TABLES":
+			if e.typ == "LAYER" {
+				color := e.int(62, white)
+				if color < 0 {
+					// negative colors mark layers which are off
+					color = -color
+				}
+				d.layers[e.str(2)] = color
+			}
+		case "ENTITIES":
+			d.entities = append(d.entities, e)
+		}
+	}
+	return d, nil
+}
+
+// parseHeader reads the header variables, which are all part of the
+// pseudo entity of the section start
+func parseHeader(d *drawing, e entity) {
+	for i, p := range e.pairs {
+		if p.code == 9 && p.value == "$INSUNITS" && i+1 < len(e.pairs) {
+			d.units, _ = strconv.Atoi(e.pairs[i+1].value)
+		}
+	}
+}
+
+// layerData collects the data blocks of a layer, lines and faces of the
+// same color are merged
+type layerData struct {
+	name   string
+	file   *rexfile.File
+	nextID uint64
+	lines  map[mgl32.Vec3]int // line set index by color
+	faces  map[mgl32.Vec3]int // mesh index by color
+}
+
+func (l *layerData) newID() uint64 {
+	id := l.nextID
+	l.nextID++
+	return id
+}
+
+// builder converts the entities into REX data blocks in local coordinates
+type builder struct {
+	d        *drawing
+	scale    float64
+	segments int
+
+	hasOrigin bool
+	origin    mgl64.Vec3
+	auto      bool // origin is taken from the first point
+
+	layers map[string]*layerData
+	order  []*layerData
+
+	// open POLYLINE and its vertices until SEQEND
+	polyline *entity
+	vertices []entity
+
+	warned map[string]bool
+}
+
+func newBuilder(d *drawing, opts Options) *builder {
+
+	b := &builder{
+		d:        d,
+		scale:    opts.Scale,
+		segments: opts.Segments,
+		layers:   make(map[string]*layerData),
+		warned:   make(map[string]bool),
+	}
+	if b.scale == 0 {
+		b.scale = 1
+		if s, ok := unitScale[d.units]; ok {
+			b.scale = s
+		}
+	}
+	if b.segments <= 0 {
+		b.segments = defaultSegments
+	}
+	if opts.Origin != nil {
+		b.hasOrigin = true
+		b.origin = *opts.Origin
+	} else if opts.LocalOrigin {
+		b.auto = true
+	}
+	return b
+}
+
+// local converts a world coordinate into scaled local coordinates
+func (b *builder) local(p mgl64.Vec3) mgl32.Vec3 {
+
+	p = p.Mul(b.scale)
+	if b.auto {
+		b.auto = false
+		b.hasOrigin = true
+		b.origin = mgl64.Vec3{math.Floor(p[0]), math.Floor(p[1]), math.Floor(p[2])}
+	}
+	if b.hasOrigin {
+		p = p.Sub(b.origin)
+	}
+	return mgl32.Vec3{float32(p[0]), float32(p[1]), float32(p[2])}
+}
+
+func (b *builder) layer(name string) *layerData {
+
+	if name == "" {
+		name = "0"
+	}
+	l, ok := b.layers[name]
+	if !ok {
+		l = &layerData{
+			name:   name,
+			file:   &rexfile.File{},
+			nextID: 1,
+			lines:  make(map[mgl32.Vec3]int),
+			faces:  make(map[mgl32.Vec3]int),
+		}
+		b.layers[name] = l
+		b.order = append(b.order, l)
+	}
+	return l
+}
+
+// color returns the true color or the ACI color of the entity, resolved by
+// its layer
+func (b *builder) color(e *entity) mgl32.Vec3 {
+
+	if rgb := e.int(420, -1); rgb >= 0 {
+		return trueColor(rgb)
+	}
+	aci := e.int(62, ByLayer)
+	if aci == ByLayer {
+		c, ok := b.d.layers[e.str(8)]
+		if !ok {
+			c = white
+		}
+		aci = c
+	}
+	if aci == ByBlock {
+		aci = white
+	}
+	return ACIColor(aci)
+}
+
+// addSegments adds the points as connected line segments
+func (b *builder) addSegments(e *entity, points []mgl64.Vec3, closed bool) {
+
+	if len(points) < 2 {
+		return
+	}
+	if closed {
+		points = append(points, points[0])
+	}
+
+	l := b.layer(e.str(8))
+	c := b.color(e)
+	idx, ok := l.lines[c]
+	if !ok {
+		idx = len(l.file.LineSets)
+		l.lines[c] = idx
+		l.file.LineSets = append(l.file.LineSets, rexfile.LineSet{ID: l.newID(), Colors: c.Vec4(1)})
+	}
+	ls := &l.file.LineSets[idx]
+	for i := 0; i+1 < len(points); i++ {
+		ls.Points = append(ls.Points, b.local(points[i]), b.local(points[i+1]))
+	}
+}
+
+// addFaces adds triangles and quads, quads with the same third and fourth
+// corner are triangles
+func (b *builder) addFaces(e *entity, faces [][]mgl64.Vec3) {
+
+	if len(faces) == 0 {
+		return
+	}
+	l := b.layer(e.str(8))
+	c := b.color(e)
+	idx, ok := l.faces[c]
+	if !ok {
+		m := rexfile.NewMaterial(l.newID())
+		m.KdRgb = c
+		m.KaRgb = c
+		l.file.Materials = append(l.file.Materials, m)
+
+		idx = len(l.file.Meshes)
+		l.faces[c] = idx
+		l.file.Meshes = append(l.file.Meshes, rexfile.Mesh{ID: l.newID(), MaterialID: m.ID})
+	}
+
+	mesh := &l.file.Meshes[idx]
+	for _, f := range faces {
+		if len(f) == 4 && f[2] == f[3] {
+			f = f[:3]
+		}
+		offset := uint32(len(mesh.Coords))
+		for _, p := range f {
+			mesh.Coords = append(mesh.Coords, b.local(p))
+		}
+		mesh.Triangles = append(mesh.Triangles, rexfile.Triangle{V0: offset, V1: offset + 1, V2: offset + 2})
+		if len(f) == 4 {
+			mesh.Triangles = append(mesh.Triangles, rexfile.Triangle{V0: offset, V1: offset + 2, V2: offset + 3})
+		}
+	}
+}
+
+func (b *builder) warn(typ string) {
+	if !b.warned[typ] {
+		b.warned[typ] = true
+		fmt.Println("WARNING: Skipping unsupported DXF entity", typ)
+	}
+}
@@ -0,0 +1,320 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dxf
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/breiting/g3next/loader"
+	"github.com/breiting/g3next/loader/rex"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/roboticeyes/gorexfile/encoding/rexfile"
+)
+
+// codes joins group codes and values as DXF lines
+func codes(pairs ...interface{}) string {
+	var sb strings.Builder
+	for _, v := range pairs {
+		fmt.Fprintf(&sb, "%v\n", v)
+	}
+	return sb.String()
+}
+
+// dxfFile returns a drawing with the header variables, the layer table and
+// the entities
+func dxfFile(header, layers, entities string) string {
+	return codes(0, "SECTION", 2, "HEADER") + header + codes(0, "ENDSEC") +
+		codes(0, "SECTION", 2, "TABLES", 0, "TABLE", 2, "LAYER") + layers + codes(0, "ENDTAB", 0, "ENDSEC") +
+		codes(0, "SECTION", 2, "ENTITIES") + entities + codes(0, "ENDSEC", 0, "EOF")
+}
+
+// length returns the total length of the line segments
+func length(ls rexfile.LineSet) float64 {
+	var l float64
+	for i := 0; i+1 < len(ls.Points); i += 2 {
+		l += float64(ls.Points[i+1].Sub(ls.Points[i]).Len())
+	}
+	return l
+}
+
+func area(mesh rexfile.Mesh) float64 {
+	var a float64
+	for _, t := range mesh.Triangles {
+		v0, v1, v2 := mesh.Coords[t.V0], mesh.Coords[t.V1], mesh.Coords[t.V2]
+		a += float64(v1.Sub(v0).Cross(v2.Sub(v0)).Len()) / 2
+	}
+	return a
+}
+
+func TestEntities(t *testing.T) {
+
+	square := codes(90, 4, 70, 1, 10, 0, 20, 0, 10, 4, 20, 0, 10, 4, 20, 4, 10, 0, 20, 4)
+	tests := []struct {
+		name      string
+		header    string
+		layers    string
+		entities  string
+		opts      Options
+		length    float64 // of all line segments
+		tolerance float64
+		triangles int
+		area      float64
+		color     mgl32.Vec3 // of the first line set or mesh
+		text      string
+		first     mgl32.Vec3 // first point, coordinate or text position
+	}{
+		{
+			name:     "line",
+			entities: codes(0, "LINE", 8, "walls", 62, 1, 10, 1, 20, 2, 30, 3, 11, 4, 21, 6, 31, 3),
+			length:   5,
+			color:    mgl32.Vec3{1, 0, 0},
+			first:    mgl32.Vec3{1, 2, 3},
+		},
+		{
+			name:     "closed polyline with layer color",
+			layers:   codes(0, "LAYER", 2, "walls", 62, -5),
+			entities: codes(0, "LWPOLYLINE", 8, "walls") + square,
+			length:   16,
+			color:    mgl32.Vec3{0, 0, 1},
+		},
+		{
+			name:      "polyline with bulge",
+			entities:  codes(0, "LWPOLYLINE", 90, 2, 70, 0, 38, 5, 10, 0, 20, 0, 42, 1, 10, 2, 20, 0),
+			length:    math.Pi,
+			tolerance: 1e-2,
+			color:     mgl32.Vec3{1, 1, 1},
+			first:     mgl32.Vec3{0, 0, 5},
+		},
+		{
+			name:      "circle",
+			entities:  codes(0, "CIRCLE", 420, 0x00ff00, 10, 1, 20, 1, 30, 0, 40, 1),
+			length:    2 * math.Pi,
+			tolerance: 1e-2,
+			color:     mgl32.Vec3{0, 1, 0},
+			first:     mgl32.Vec3{2, 1, 0},
+		},
+		{
+			name:      "arc",
+			entities:  codes(0, "ARC", 10, 0, 20, 0, 30, 0, 40, 2, 50, 0, 51, 90),
+			opts:      Options{Segments: 360},
+			length:    math.Pi,
+			tolerance: 1e-3,
+			color:     mgl32.Vec3{1, 1, 1},
+			first:     mgl32.Vec3{2, 0, 0},
+		},
+		{
+			name: "2D polyline with flipped extrusion",
+			entities: codes(0, "POLYLINE", 70, 0, 10, 0, 20, 0, 30, 2, 210, 0, 220, 0, 230, -1,
+				0, "VERTEX", 10, 1, 20, 1, 0, "VERTEX", 10, 3, 20, 1, 0, "SEQEND"),
+			length: 2,
+			color:  mgl32.Vec3{1, 1, 1},
+			first:  mgl32.Vec3{-1, 1, -2},
+		},
+		{
+			name:      "3D faces",
+			entities:  codes(0, "3DFACE", 10, 0, 20, 0, 11, 2, 21, 0, 12, 2, 22, 2, 13, 0, 23, 2, 0, "3DFACE", 10, 0, 20, 0, 11, 1, 21, 0, 12, 0, 22, 1, 13, 0, 23, 1),
+			triangles: 3,
+			area:      4.5,
+			color:     mgl32.Vec3{1, 1, 1},
+			first:     mgl32.Vec3{0, 0, 0},
+		},
+		{
+			name: "polyface mesh",
+			entities: codes(0, "POLYLINE", 70, 64,
+				0, "VERTEX", 70, 192, 10, 0, 20, 0, 0, "VERTEX", 70, 192, 10, 1, 20, 0,
+				0, "VERTEX", 70, 192, 10, 1, 20, 1, 0, "VERTEX", 70, 192, 10, 0, 20, 1,
+				0, "VERTEX", 70, 128, 71, 1, 72, -2, 73, 3, 74, 4, 0, "SEQEND"),
+			triangles: 2,
+			area:      1,
+			color:     mgl32.Vec3{1, 1, 1},
+		},
+		{
+			name: "polygon mesh",
+			entities: codes(0, "POLYLINE", 70, 16, 71, 2, 72, 3,
+				0, "VERTEX", 10, 0, 20, 0, 0, "VERTEX", 10, 0, 20, 1, 0, "VERTEX", 10, 0, 20, 2,
+				0, "VERTEX", 10, 1, 20, 0, 0, "VERTEX", 10, 1, 20, 1, 0, "VERTEX", 10, 1, 20, 2, 0, "SEQEND"),
+			triangles: 4,
+			area:      2,
+			color:     mgl32.Vec3{1, 1, 1},
+		},
+		{
+			name:     "text in millimeters",
+			header:   codes(9, "$INSUNITS", 70, 4),
+			entities: codes(0, "TEXT", 10, 1000, 20, 2000, 30, 0, 40, 250, 1, "45%%d"),
+			text:     "45°",
+			first:    mgl32.Vec3{1, 2, 0},
+		},
+		{
+			name:     "scale and origin",
+			header:   codes(9, "$INSUNITS", 70, 4),
+			entities: codes(0, "LINE", 10, 100, 20, 100, 11, 200, 21, 100),
+			opts:     Options{Scale: 2, LoadOptions: rex.LoadOptions{Origin: &mgl64.Vec3{100, 0, 0}}},
+			length:   200,
+			color:    mgl32.Vec3{1, 1, 1},
+			first:    mgl32.Vec3{100, 200, 0},
+		},
+		{
+			name:     "unsupported entity",
+			entities: codes(0, "INSERT", 2, "door", 10, 0, 20, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			d, err := parse(strings.NewReader(dxfFile(tt.header, tt.layers, tt.entities)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := newBuilder(d, tt.opts)
+			for _, e := range d.entities {
+				b.add(e)
+			}
+
+			var lines []rexfile.LineSet
+			var meshes []rexfile.Mesh
+			var texts []rexfile.Text
+			for _, l := range b.order {
+				lines = append(lines, l.file.LineSets...)
+				meshes = append(meshes, l.file.Meshes...)
+				texts = append(texts, l.file.Texts...)
+			}
+
+			var first *mgl32.Vec3
+			var total float64
+			for _, ls := range lines {
+				total += length(ls)
+				if first == nil {
+					first = &ls.Points[0]
+					if c := ls.Colors.Vec3(); c != tt.color {
+						t.Errorf("color is %v, want %v", c, tt.color)
+					}
+				}
+			}
+			if math.Abs(total-tt.length) > tt.tolerance+1e-4 {
+				t.Errorf("length is %v, want %v", total, tt.length)
+			}
+
+			var triangles int
+			var a float64
+			for _, m := range meshes {
+				triangles += len(m.Triangles)
+				a += area(m)
+				if first == nil {
+					first = &m.Coords[0]
+				}
+			}
+			if triangles != tt.triangles || math.Abs(a-tt.area) > 1e-4 {
+				t.Errorf("got %d triangles with an area of %v, want %d and %v", triangles, a, tt.triangles, tt.area)
+			}
+
+			if tt.text != "" {
+				if len(texts) != 1 || texts[0].Text != tt.text || !mgl32.FloatEqual(texts[0].FontSize, 0.25) {
+					t.Fatalf("got texts %v, want %s", texts, tt.text)
+				}
+				first = &texts[0].Position
+			}
+			if first != nil && !first.ApproxEqualThreshold(tt.first, 1e-4) {
+				t.Errorf("first point is %v, want %v", *first, tt.first)
+			}
+			if first == nil && (tt.length > 0 || tt.triangles > 0) {
+				t.Errorf("no data")
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+
+	line := codes(0, "LINE", 10, 0, 20, 0, 11, 1, 21, 0)
+	tests := []struct {
+		name     string
+		data     string
+		entities int
+		error    bool
+	}{
+		{"valid", dxfFile("", "", line), 1, false},
+		{"trailing blank lines", dxfFile("", "", line) + "\n\n  \n", 1, false},
+		{"trailing garbage", dxfFile("", "", line) + "written by hand\n", 1, false},
+		{"crlf", strings.Replace(dxfFile("", "", line), "\n", "\r\n", -1), 1, false},
+		{"without eof", codes(0, "SECTION", 2, "ENTITIES") + line + codes(0, "ENDSEC"), 1, false},
+		{"invalid group code", codes(0, "SECTION", 2, "ENTITIES", "x", "LINE"), 0, true},
+		{"missing value", codes(0, "SECTION", 2), 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := parse(strings.NewReader(tt.data))
+			if tt.error {
+				if err == nil {
+					t.Errorf("no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(d.entities) != tt.entities {
+				t.Errorf("%d entities, want %d", len(d.entities), tt.entities)
+			}
+		})
+	}
+}
+
+func TestNewGroup(t *testing.T) {
+
+	data := dxfFile("", codes(0, "LAYER", 2, "walls", 62, 3, 0, "LAYER", 2, "floor", 62, 2),
+		codes(0, "LINE", 8, "walls", 10, 1000.5, 20, 2000.5, 11, 1001.5, 21, 2000.5)+
+			codes(0, "3DFACE", 8, "floor", 10, 1000, 20, 2000, 11, 1001, 21, 2000, 12, 1001, 22, 2001, 13, 1001, 23, 2001)+
+			codes(0, "TEXT", 8, "floor", 10, 1000, 20, 2000, 1, "room"))
+
+	dec := NewDecoderReader(strings.NewReader(data))
+	dec.SetOptions(Options{LoadOptions: rex.LoadOptions{LocalOrigin: true}})
+	group, err := dec.NewGroup("plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if geo, ok := rex.GeoreferenceOf(group); !ok || geo.Origin != (mgl64.Vec3{1000, 2000, 0}) {
+		t.Errorf("got georeference %v, want the floored first point", geo)
+	}
+	layers := group.Children()
+	if len(layers) != 2 {
+		t.Fatalf("%d layers, want 2", len(layers))
+	}
+	tests := []struct {
+		name  string
+		color int
+		nodes int
+	}{
+		{"walls", 3, 1},
+		{"floor", 2, 2},
+	}
+	for i, tt := range tests {
+		children := layers[i].GetNode().Children()
+		if len(children) != tt.nodes {
+			t.Errorf("layer %s has %d nodes, want %d", tt.name, len(children), tt.nodes)
+			continue
+		}
+		// the layer is found from its nodes
+		l, ok := LayerOf(children[0])
+		if !ok || l.Name != tt.name || l.Color != tt.color {
+			t.Errorf("got layer %+v, want %s with color %d", l, tt.name, tt.color)
+		}
+	}
+
+	// registered by the file extension
+	group, err = loader.Load(strings.NewReader(data+"\n"), "plan.dxf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(group.Children()) != 2 {
+		t.Errorf("%d layers, want 2", len(group.Children()))
+	}
+}
@@ -0,0 +1,304 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dxf
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/roboticeyes/gorexfile/encoding/rexfile"
+)
+
+// polyline flags
+const (
+	polylineClosed   = 1 // closed in M direction for polygon meshes
+	polylineNClosed  = 32
+	polyline3D       = 8
+	polygonMesh      = 16
+	polyfaceMesh     = 64
+	vertexPolyface   = 128
+	vertexMeshVertex = 64
+)
+
+// add converts a single entity. POLYLINE entities are collected with their
+// VERTEX entities until SEQEND.
+func (b *builder) add(e entity) {
+
+	switch e.typ {
+	case "POLYLINE":
+		b.polyline = &e
+		b.vertices = nil
+		return
+	case "VERTEX":
+		if b.polyline != nil {
+			b.vertices = append(b.vertices, e)
+		}
+		return
+	case "SEQEND":
+		if b.polyline != nil {
+			b.addPolyline(b.polyline, b.vertices)
+		}
+		b.polyline = nil
+		b.vertices = nil
+		return
+	}
+
+	switch e.typ {
+	case "LINE":
+		b.addSegments(&e, []mgl64.Vec3{e.point(10), e.point(11)}, false)
+	case "LWPOLYLINE":
+		b.addLWPolyline(&e)
+	case "CIRCLE":
+		b.addArc(&e, 0, 360)
+	case "ARC":
+		b.addArc(&e, e.float(50, 0), e.float(51, 360))
+	case "3DFACE":
+		b.addFaces(&e, [][]mgl64.Vec3{{e.point(10), e.point(11), e.point(12), e.point(13)}})
+	case "TEXT":
+		b.addText(&e)
+	default:
+		b.warn(e.typ)
+	}
+}
+
+// addLWPolyline adds a 2D polyline, arcs given by a bulge are tessellated
+func (b *builder) addLWPolyline(e *entity) {
+
+	var points []mgl64.Vec3
+	var bulges []float64
+	for _, p := range e.pairs {
+		switch p.code {
+		case 10:
+			points = append(points, mgl64.Vec3{parseFloat(p.value), 0, 0})
+			bulges = append(bulges, 0)
+		case 20:
+			if len(points) > 0 {
+				points[len(points)-1][1] = parseFloat(p.value)
+			}
+		case 42:
+			if len(bulges) > 0 {
+				bulges[len(bulges)-1] = parseFloat(p.value)
+			}
+		}
+	}
+
+	elevation := e.float(38, 0)
+	for i := range points {
+		points[i][2] = elevation
+	}
+	closed := e.int(70, 0)&polylineClosed != 0
+	b.addSegments(e, b.toWorld(e, b.bulgePoints(points, bulges, closed)), closed)
+}
+
+// addPolyline adds 2D and 3D polylines as lines and polygon and polyface
+// meshes as faces
+func (b *builder) addPolyline(e *entity, vertices []entity) {
+
+	flags := e.int(70, 0)
+
+	switch {
+	case flags&polyfaceMesh != 0:
+		var coords []mgl64.Vec3
+		var faces [][]mgl64.Vec3
+		for _, v := range vertices {
+			vflags := v.int(70, 0)
+			if vflags&vertexMeshVertex != 0 {
+				coords = append(coords, v.point(10))
+				continue
+			}
+			if vflags&vertexPolyface == 0 {
+				continue
+			}
+			// face records reference the vertices 1-based, negative for invisible edges
+			var face []mgl64.Vec3
+			for code := 71; code <= 74; code++ {
+				idx := v.int(code, 0)
+				if idx < 0 {
+					idx = -idx
+				}
+				if idx > 0 && idx <= len(coords) {
+					face = append(face, coords[idx-1])
+				}
+			}
+			if len(face) >= 3 {
+				faces = append(faces, face)
+			}
+		}
+		b.addFaces(e, faces)
+
+	case flags&polygonMesh != 0:
+		m, n := e.int(71, 0), e.int(72, 0)
+		if m < 2 || n < 2 || len(vertices) < m*n {
+			return
+		}
+		at := func(i, j int) mgl64.Vec3 {
+			return vertices[(i%m)*n+j%n].point(10)
+		}
+		mEnd, nEnd := m-1, n-1
+		if flags&polylineClosed != 0 {
+			mEnd = m
+		}
+		if flags&polylineNClosed != 0 {
+			nEnd = n
+		}
+		var faces [][]mgl64.Vec3
+		for i := 0; i < mEnd; i++ {
+			for j := 0; j < nEnd; j++ {
+				faces = append(faces, []mgl64.Vec3{at(i, j), at(i+1, j), at(i+1, j+1), at(i, j+1)})
+			}
+		}
+		b.addFaces(e, faces)
+
+	default:
+		var points []mgl64.Vec3
+		var bulges []float64
+		for _, v := range vertices {
+			points = append(points, v.point(10))
+			bulges = append(bulges, v.float(42, 0))
+		}
+		closed := flags&polylineClosed != 0
+		if flags&polyline3D != 0 {
+			b.addSegments(e, points, closed)
+			return
+		}
+		// 2D polylines are in object coordinates at the elevation of the polyline
+		elevation := e.point(10).Z()
+		for i := range points {
+			points[i][2] = elevation
+		}
+		b.addSegments(e, b.toWorld(e, b.bulgePoints(points, bulges, closed)), closed)
+	}
+}
+
+// addArc adds a circle or an arc, the angles are counter-clockwise in degrees
+func (b *builder) addArc(e *entity, start, end float64) {
+
+	center := e.point(10)
+	r := e.float(40, 0)
+	if r <= 0 {
+		return
+	}
+
+	for end <= start {
+		end += 360
+	}
+	sweep := (end - start) * math.Pi / 180
+	n := int(math.Ceil(sweep / (2 * math.Pi) * float64(b.segments)))
+	if n < 1 {
+		n = 1
+	}
+
+	var points []mgl64.Vec3
+	for i := 0; i <= n; i++ {
+		a := start*math.Pi/180 + sweep*float64(i)/float64(n)
+		points = append(points, mgl64.Vec3{center.X() + r*math.Cos(a), center.Y() + r*math.Sin(a), center.Z()})
+	}
+	if e.typ == "CIRCLE" {
+		// the last point is the same as the first one
+		points = points[:len(points)-1]
+	}
+	b.addSegments(e, b.toWorld(e, points), e.typ == "CIRCLE")
+}
+
+func (b *builder) addText(e *entity) {
+
+	text := textReplacer.Replace(e.str(1))
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	pos := b.toWorld(e, []mgl64.Vec3{e.point(10)})[0]
+	c := b.color(e)
+
+	l := b.layer(e.str(8))
+	l.file.Texts = append(l.file.Texts, rexfile.Text{
+		ID:       l.newID(),
+		Red:      c.X(),
+		Green:    c.Y(),
+		Blue:     c.Z(),
+		Alpha:    1,
+		Position: b.local(pos),
+		FontSize: float32(e.float(40, 1) * b.scale),
+		Text:     text,
+	})
+}
+
+// textReplacer resolves the control codes for special characters
+var textReplacer = strings.NewReplacer("%%d", "°", "%%D", "°", "%%c", "Ø", "%%C", "Ø", "%%p", "±", "%%P", "±", "%%%", "%")
+
+// bulgePoints returns the points with arc segments inserted for non-zero
+// bulges. The bulge of a point defines the arc to the next point, it is the
+// tangent of a quarter of the included angle.
+func (b *builder) bulgePoints(points []mgl64.Vec3, bulges []float64, closed bool) []mgl64.Vec3 {
+
+	var out []mgl64.Vec3
+	for i, p := range points {
+		out = append(out, p)
+		next := i + 1
+		if next == len(points) {
+			if !closed {
+				break
+			}
+			next = 0
+		}
+		bulge := bulges[i]
+		if bulge == 0 {
+			continue
+		}
+
+		q := points[next]
+		d := mgl64.Vec2{q.X() - p.X(), q.Y() - p.Y()}
+		chord := d.Len()
+		if chord == 0 {
+			continue
+		}
+		angle := 4 * math.Atan(bulge)
+		// the center lies on the left of the chord for positive bulges
+		normal := mgl64.Vec2{-d.Y() / chord, d.X() / chord}
+		offset := chord * (1 - bulge*bulge) / (4 * bulge)
+		center := mgl64.Vec2{(p.X()+q.X())/2 + normal.X()*offset, (p.Y()+q.Y())/2 + normal.Y()*offset}
+		r := math.Hypot(p.X()-center.X(), p.Y()-center.Y())
+		a0 := math.Atan2(p.Y()-center.Y(), p.X()-center.X())
+
+		n := int(math.Ceil(math.Abs(angle) / (2 * math.Pi) * float64(b.segments)))
+		for k := 1; k < n; k++ {
+			a := a0 + angle*float64(k)/float64(n)
+			out = append(out, mgl64.Vec3{center.X() + r*math.Cos(a), center.Y() + r*math.Sin(a), p.Z()})
+		}
+	}
+	// a closing arc ends at the first point, which is added by addSegments
+	return out
+}
+
+// toWorld converts points from the object coordinate system of the entity
+// into world coordinates (arbitrary axis algorithm)
+func (b *builder) toWorld(e *entity, points []mgl64.Vec3) []mgl64.Vec3 {
+
+	n := e.extrusion()
+	if n.Len() == 0 || (n.X() == 0 && n.Y() == 0 && n.Z() > 0) {
+		return points
+	}
+	n = n.Normalize()
+
+	var ax mgl64.Vec3
+	if math.Abs(n.X()) < 1.0/64 && math.Abs(n.Y()) < 1.0/64 {
+		ax = mgl64.Vec3{0, 1, 0}.Cross(n).Normalize()
+	} else {
+		ax = mgl64.Vec3{0, 0, 1}.Cross(n).Normalize()
+	}
+	ay := n.Cross(ax).Normalize()
+
+	out := make([]mgl64.Vec3, len(points))
+	for i, p := range points {
+		out[i] = ax.Mul(p.X()).Add(ay.Mul(p.Y())).Add(n.Mul(p.Z()))
+	}
+	return out
+}
+
+func parseFloat(s string) float64 {
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
@@ -0,0 +1,23 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dxf
+
+import (
+	"io"
+
+	"github.com/breiting/g3next/loader"
+	"github.com/g3n/engine/core"
+)
+
+func init() {
+	// ASCII DXF files have no fixed magic bytes
+	loader.Register(loader.Format{
+		Name:       "DXF",
+		Extensions: []string{".dxf"},
+		Load: func(r io.Reader, name string) (*core.Node, error) {
+			return NewDecoderReader(r).NewGroup(name)
+		},
+	})
+}
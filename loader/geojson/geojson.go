@@ -0,0 +1,542 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package geojson imports GeoJSON files (RFC 7946). Every feature becomes a
+// group with its properties attached as user data (see FeatureOf). Points
+// are loaded as point lists or markers, lines as REX line sets and polygons
+// as flat or extruded meshes. Colors are taken from the simplestyle
+// properties stroke, fill, fill-opacity and marker-color if present.
+package geojson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/breiting/g3next/geom"
+	"github.com/breiting/g3next/loader/gps"
+	"github.com/breiting/g3next/loader/rex"
+	"github.com/g3n/engine/core"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/roboticeyes/gorexfile/encoding/rexfile"
+)
+
+// Options control how the GeoJSON content is converted
+type Options struct {
+	rex.LoadOptions
+
+	// Projected treats the coordinates as metric CRS coordinates (e.g. UTM)
+	// instead of WGS84 longitude and latitude. The origin of the local
+	// coordinates is LoadOptions.Origin or the first coordinate, floored to
+	// full meters. It is stored as georeference of the group.
+	Projected bool
+
+	// GeoOrigin is the origin of the local east-north-up frame for WGS84
+	// coordinates, the first coordinate if nil
+	GeoOrigin *gps.Position
+
+	// HeightProperty is the numeric feature property polygons are extruded
+	// by. Polygons are flat if empty or if a feature has no such property.
+	HeightProperty string
+
+	// Markers shows points as small meshes instead of point lists
+	Markers bool
+
+	// MarkerSize is the size of the markers in meters, 1 if 0
+	MarkerSize float32
+}
+
+// Feature is attached as user data to the group of every feature
+type Feature struct {
+	ID         interface{}
+	Properties map[string]interface{}
+}
+
+// FeatureOf returns the feature of the node or of its closest parent
+func FeatureOf(inode core.INode) (*Feature, bool) {
+
+	for inode != nil {
+		if f, ok := inode.GetNode().UserData().(*Feature); ok {
+			return f, true
+		}
+		inode = inode.GetNode().Parent()
+	}
+	return nil, false
+}
+
+// object is any GeoJSON object, only the members of its type are set
+type object struct {
+	Type        string                 `json:"type"`
+	ID          interface{}            `json:"id"`
+	Properties  map[string]interface{} `json:"properties"`
+	Geometry    *object                `json:"geometry"`
+	Features    []object               `json:"features"`
+	Geometries  []object               `json:"geometries"`
+	Coordinates json.RawMessage        `json:"coordinates"`
+}
+
+// Decoder is the GeoJSON file decoder
+type Decoder struct {
+	r    io.Reader
+	opts Options
+}
+
+// NewDecoder reads the GeoJSON file
+func NewDecoder(geojsonFile string) (*Decoder, error) {
+
+	data, err := ioutil.ReadFile(geojsonFile)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot open file %s", geojsonFile)
+	}
+	return &Decoder{r: bytes.NewReader(data)}, nil
+}
+
+// NewDecoderReader creates a decoder with a reader
+func NewDecoderReader(r io.Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+// SetOptions sets the options used for building the scene graph
+func (dec *Decoder) SetOptions(opts Options) {
+	dec.opts = opts
+}
+
+// NewGroup decodes the GeoJSON file and returns a group with a child group
+// per feature. A single geometry without feature is loaded as one feature
+// without properties.
+func (dec *Decoder) NewGroup(name string) (*core.Node, error) {
+
+	var root object
+	if err := json.NewDecoder(dec.r).Decode(&root); err != nil {
+		return nil, fmt.Errorf("Cannot read GeoJSON file: %v", err)
+	}
+
+	var features []object
+	switch root.Type {
+	case "FeatureCollection":
+		features = root.Features
+	case "Feature":
+		features = []object{root}
+	default:
+		features = []object{{Type: "Feature", Geometry: &root}}
+	}
+
+	b := &builder{opts: dec.opts}
+	group := core.NewNode()
+	group.SetName(name)
+	for i, f := range features {
+		node, err := b.feature(f, i)
+		if err != nil {
+			return nil, err
+		}
+		if node != nil {
+			group.Add(node)
+		}
+	}
+	if dec.opts.Projected && b.hasOrigin {
+		group.SetUserData(&rex.Georeference{Origin: b.origin})
+	}
+	return group, nil
+}
+
+// builder converts the features into REX data blocks in local coordinates
+type builder struct {
+	opts Options
+
+	// origin of projected coordinates or of the east-north-up frame
+	hasOrigin bool
+	origin    mgl64.Vec3
+	proj      *gps.Projection
+
+	file   *rexfile.File
+	nextID uint64
+}
+
+func (b *builder) newID() uint64 {
+	id := b.nextID
+	b.nextID++
+	return id
+}
+
+// feature builds the group of a feature, nil if the feature has no geometry
+func (b *builder) feature(f object, index int) (*core.Node, error) {
+
+	if f.Geometry == nil {
+		return nil, nil
+	}
+
+	b.file = &rexfile.File{}
+	b.nextID = 1
+	if err := b.geometry(*f.Geometry, f.Properties); err != nil {
+		return nil, fmt.Errorf("Cannot read GeoJSON feature %d: %v", index, err)
+	}
+
+	name := fmt.Sprintf("feature-%d", index)
+	if s, ok := f.Properties["name"].(string); ok && s != "" {
+		name = s
+	} else if f.ID != nil {
+		name = fmt.Sprint(f.ID)
+	}
+
+	// the coordinates are already local
+	opts := b.opts.LoadOptions
+	opts.Origin = nil
+	opts.LocalOrigin = false
+
+	group, _, err := rex.CreateRexNodeOptions(b.file, name, opts)
+	if err != nil {
+		return nil, err
+	}
+	group.SetUserData(&Feature{ID: f.ID, Properties: f.Properties})
+	return group, nil
+}
+
+func (b *builder) geometry(g object, props map[string]interface{}) error {
+
+	if g.Type == "GeometryCollection" {
+		for _, child := range g.Geometries {
+			if err := b.geometry(child, props); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if len(g.Coordinates) == 0 || string(g.Coordinates) == "null" {
+		return nil
+	}
+
+	var err error
+	switch g.Type {
+	case "Point":
+		var c []float64
+		if err = json.Unmarshal(g.Coordinates, &c); err == nil {
+			err = b.points([][]float64{c}, props)
+		}
+	case "MultiPoint":
+		var c [][]float64
+		if err = json.Unmarshal(g.Coordinates, &c); err == nil {
+			err = b.points(c, props)
+		}
+	case "LineString":
+		var c [][]float64
+		if err = json.Unmarshal(g.Coordinates, &c); err == nil {
+			err = b.line(c, props)
+		}
+	case "MultiLineString":
+		var c [][][]float64
+		if err = json.Unmarshal(g.Coordinates, &c); err == nil {
+			for _, line := range c {
+				if err = b.line(line, props); err != nil {
+					break
+				}
+			}
+		}
+	case "Polygon":
+		var c [][][]float64
+		if err = json.Unmarshal(g.Coordinates, &c); err == nil {
+			err = b.polygon(c, props)
+		}
+	case "MultiPolygon":
+		var c [][][][]float64
+		if err = json.Unmarshal(g.Coordinates, &c); err == nil {
+			for _, polygon := range c {
+				if err = b.polygon(polygon, props); err != nil {
+					break
+				}
+			}
+		}
+	default:
+		fmt.Println("WARNING: Skipping unsupported GeoJSON geometry", g.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s: %v", g.Type, err)
+	}
+	return nil
+}
+
+// local converts a GeoJSON position into local metric coordinates
+func (b *builder) local(c []float64) (mgl64.Vec3, error) {
+
+	if len(c) < 2 {
+		return mgl64.Vec3{}, fmt.Errorf("position with %d values", len(c))
+	}
+	p := mgl64.Vec3{c[0], c[1], 0}
+	if len(c) > 2 {
+		p[2] = c[2]
+	}
+
+	if b.opts.Projected {
+		if !b.hasOrigin {
+			b.hasOrigin = true
+			if b.opts.Origin != nil {
+				b.origin = *b.opts.Origin
+			} else {
+				b.origin = mgl64.Vec3{math.Floor(p[0]), math.Floor(p[1]), math.Floor(p[2])}
+			}
+		}
+		return p.Sub(b.origin), nil
+	}
+
+	pos := gps.Position{Lon: p[0], Lat: p[1], Elevation: p[2]}
+	if b.proj == nil {
+		origin := pos
+		if b.opts.GeoOrigin != nil {
+			origin = *b.opts.GeoOrigin
+		}
+		b.proj = gps.NewProjection(origin)
+	}
+	v := b.proj.Project(pos)
+	return mgl64.Vec3{float64(v[0]), float64(v[1]), float64(v[2])}, nil
+}
+
+func (b *builder) localAll(coords [][]float64) ([]mgl64.Vec3, error) {
+
+	points := make([]mgl64.Vec3, len(coords))
+	for i, c := range coords {
+		p, err := b.local(c)
+		if err != nil {
+			return nil, err
+		}
+		points[i] = p
+	}
+	return points, nil
+}
+
+func (b *builder) points(coords [][]float64, props map[string]interface{}) error {
+
+	points, err := b.localAll(coords)
+	if err != nil || len(points) == 0 {
+		return err
+	}
+	color, hasColor := colorProperty(props, "marker-color")
+
+	if !b.opts.Markers {
+		pl := rexfile.PointList{ID: b.newID()}
+		for _, p := range points {
+			pl.Points = append(pl.Points, vec32(p))
+			if hasColor {
+				pl.Colors = append(pl.Colors, color)
+			}
+		}
+		b.file.PointLists = append(b.file.PointLists, pl)
+		return nil
+	}
+
+	materialID := uint64(rexfile.NotSpecified)
+	if hasColor {
+		materialID = b.material(color, 1)
+	}
+	size := b.opts.MarkerSize
+	if size == 0 {
+		size = 1
+	}
+	for _, p := range points {
+		mesh := marker(vec32(p), size/2)
+		mesh.ID = b.newID()
+		mesh.MaterialID = materialID
+		b.file.Meshes = append(b.file.Meshes, mesh)
+	}
+	return nil
+}
+
+func (b *builder) line(coords [][]float64, props map[string]interface{}) error {
+
+	points, err := b.localAll(coords)
+	if err != nil || len(points) < 2 {
+		return err
+	}
+	ls := rexfile.LineSet{ID: b.newID(), Colors: mgl32.Vec4{1, 1, 1, 1}}
+	if c, ok := colorProperty(props, "stroke"); ok {
+		ls.Colors = c.Vec4(1)
+	}
+	for _, p := range points {
+		ls.Points = append(ls.Points, vec32(p))
+	}
+	b.file.LineSets = append(b.file.LineSets, ls)
+	return nil
+}
+
+// polygon adds the triangulated polygon, extruded if it has a height
+func (b *builder) polygon(rings [][][]float64, props map[string]interface{}) error {
+
+	if len(rings) == 0 {
+		return nil
+	}
+	var outer []mgl64.Vec3
+	var holes [][]mgl64.Vec3
+	for i, r := range rings {
+		points, err := b.localAll(r)
+		if err != nil {
+			return err
+		}
+		ring := geom.CleanRing(points, i == 0)
+		if i == 0 {
+			if ring == nil {
+				return nil
+			}
+			outer = ring
+		} else if ring != nil {
+			holes = append(holes, ring)
+		}
+	}
+
+	mesh := rexfile.Mesh{ID: b.newID(), MaterialID: rexfile.NotSpecified}
+	if c, ok := colorProperty(props, "fill"); ok {
+		alpha := float32(1)
+		if a, ok := numberProperty(props, "fill-opacity"); ok {
+			alpha = float32(a)
+		}
+		mesh.MaterialID = b.material(c, alpha)
+	}
+
+	triangles := geom.Triangulate(outer, holes)
+	all := append([]mgl64.Vec3(nil), outer...)
+	for _, h := range holes {
+		all = append(all, h...)
+	}
+
+	height, extrude := 0.0, false
+	if b.opts.HeightProperty != "" {
+		height, extrude = numberProperty(props, b.opts.HeightProperty)
+	}
+	if !extrude {
+		// flat polygons keep the elevation of their coordinates
+		for _, p := range all {
+			mesh.Coords = append(mesh.Coords, vec32(p))
+		}
+		for _, t := range triangles {
+			mesh.Triangles = append(mesh.Triangles, rexfile.Triangle{V0: uint32(t[0]), V1: uint32(t[1]), V2: uint32(t[2])})
+		}
+		b.file.Meshes = append(b.file.Meshes, mesh)
+		return nil
+	}
+
+	base := math.MaxFloat64
+	for _, p := range all {
+		base = math.Min(base, p.Z())
+	}
+	extrudeMesh(&mesh, append([][]mgl64.Vec3{outer}, holes...), all, triangles, base, base+height)
+	b.file.Meshes = append(b.file.Meshes, mesh)
+	return nil
+}
+
+// material adds a material with the diffuse color and returns its ID
+func (b *builder) material(color mgl32.Vec3, alpha float32) uint64 {
+
+	m := rexfile.NewMaterial(b.newID())
+	m.KdRgb = color
+	m.KaRgb = color
+	m.Alpha = alpha
+	b.file.Materials = append(b.file.Materials, m)
+	return m.ID
+}
+
+// extrudeMesh adds bottom, top and walls between the two heights. Every face
+// gets its own vertices, so that the calculated normals are not smoothed
+// across the edges.
+func extrudeMesh(mesh *rexfile.Mesh, rings [][]mgl64.Vec3, all []mgl64.Vec3, triangles [][3]int, bottom, top float64) {
+
+	add := func(p mgl64.Vec3, z float64) uint32 {
+		mesh.Coords = append(mesh.Coords, mgl32.Vec3{float32(p.X()), float32(p.Y()), float32(z)})
+		return uint32(len(mesh.Coords) - 1)
+	}
+
+	for _, z := range []float64{top, bottom} {
+		offset := uint32(len(mesh.Coords))
+		for _, p := range all {
+			add(p, z)
+		}
+		for _, t := range triangles {
+			tri := rexfile.Triangle{V0: offset + uint32(t[0]), V1: offset + uint32(t[1]), V2: offset + uint32(t[2])}
+			if z == bottom {
+				// the bottom faces downwards
+				tri.V1, tri.V2 = tri.V2, tri.V1
+			}
+			mesh.Triangles = append(mesh.Triangles, tri)
+		}
+	}
+
+	// outer rings are counter-clockwise and holes clockwise, so the walls
+	// face outwards of the solid in both cases
+	for _, ring := range rings {
+		for i, a := range ring {
+			c := ring[(i+1)%len(ring)]
+			v0, v1 := add(a, bottom), add(c, bottom)
+			v2, v3 := add(c, top), add(a, top)
+			mesh.Triangles = append(mesh.Triangles,
+				rexfile.Triangle{V0: v0, V1: v1, V2: v2},
+				rexfile.Triangle{V0: v0, V1: v2, V2: v3})
+		}
+	}
+}
+
+// marker returns an octahedron around the center
+func marker(center mgl32.Vec3, r float32) rexfile.Mesh {
+
+	mesh := rexfile.Mesh{
+		Coords: []mgl32.Vec3{
+			center.Add(mgl32.Vec3{r, 0, 0}),
+			center.Add(mgl32.Vec3{0, r, 0}),
+			center.Add(mgl32.Vec3{-r, 0, 0}),
+			center.Add(mgl32.Vec3{0, -r, 0}),
+			center.Add(mgl32.Vec3{0, 0, r}),
+			center.Add(mgl32.Vec3{0, 0, -r}),
+		},
+	}
+	for i := uint32(0); i < 4; i++ {
+		next := (i + 1) % 4
+		mesh.Triangles = append(mesh.Triangles,
+			rexfile.Triangle{V0: i, V1: next, V2: 4},
+			rexfile.Triangle{V0: next, V1: i, V2: 5})
+	}
+	return mesh
+}
+
+func vec32(p mgl64.Vec3) mgl32.Vec3 {
+	return mgl32.Vec3{float32(p[0]), float32(p[1]), float32(p[2])}
+}
+
+// colorProperty parses a hex color like #ff8800 or #f80
+func colorProperty(props map[string]interface{}, name string) (mgl32.Vec3, bool) {
+
+	s, ok := props[name].(string)
+	if !ok {
+		return mgl32.Vec3{}, false
+	}
+	s = strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+	if len(s) != 6 {
+		return mgl32.Vec3{}, false
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return mgl32.Vec3{}, false
+	}
+	return mgl32.Vec3{
+		float32(v>>16&0xff) / 255,
+		float32(v>>8&0xff) / 255,
+		float32(v&0xff) / 255,
+	}, true
+}
+
+// numberProperty returns a numeric property, numbers given as string are accepted
+func numberProperty(props map[string]interface{}, name string) (float64, bool) {
+
+	switch v := props[name].(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
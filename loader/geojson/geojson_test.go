@@ -0,0 +1,279 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geojson
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/breiting/g3next/loader"
+	"github.com/breiting/g3next/loader/gps"
+	"github.com/breiting/g3next/loader/rex"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/roboticeyes/gorexfile/encoding/rexfile"
+)
+
+// measure returns the area and the signed volume of the mesh, the volume is
+// positive for closed meshes with outward faces
+func measure(mesh rexfile.Mesh) (area, volume float64) {
+	for _, t := range mesh.Triangles {
+		v0, v1, v2 := mesh.Coords[t.V0], mesh.Coords[t.V1], mesh.Coords[t.V2]
+		area += float64(v1.Sub(v0).Cross(v2.Sub(v0)).Len()) / 2
+		volume += float64(v0.Dot(v1.Cross(v2))) / 6
+	}
+	return area, volume
+}
+
+func TestGeometry(t *testing.T) {
+
+	const (
+		square = `[[10,10],[14,10],[14,14],[10,14],[10,10]]`
+		hole   = `[[11,11],[11,13],[13,13],[13,11],[11,11]]`
+		lShape = `[[12,11],[11,11],[11,12],[10,12],[10,10],[12,10],[12,11]]`
+	)
+
+	tests := []struct {
+		name       string
+		geometry   string
+		properties string
+		opts       Options
+		points     int
+		lines      int
+		meshes     int
+		area       float64 // of all meshes
+		volume     float64
+		color      *mgl32.Vec3
+	}{
+		{
+			name:     "point",
+			geometry: `{"type":"Point","coordinates":[10,10,5]}`,
+			points:   1,
+		},
+		{
+			name:       "colored points",
+			geometry:   `{"type":"MultiPoint","coordinates":[[10,10],[11,11]]}`,
+			properties: `{"marker-color":"#f00"}`,
+			points:     2,
+			color:      &mgl32.Vec3{1, 0, 0},
+		},
+		{
+			name:     "markers",
+			geometry: `{"type":"MultiPoint","coordinates":[[10,10],[11,11]]}`,
+			opts:     Options{Markers: true, MarkerSize: 2},
+			meshes:   2,
+			area:     2 * 8 * math.Sqrt(3) / 2,
+			volume:   2 * 4.0 / 3,
+		},
+		{
+			name:       "lines",
+			geometry:   `{"type":"MultiLineString","coordinates":[[[10,10],[11,11],[12,10]],[[10,10],[10,11]],[[10,10]]]}`,
+			properties: `{"stroke":"#00ff00"}`,
+			lines:      2,
+			color:      &mgl32.Vec3{0, 1, 0},
+		},
+		{
+			name:     "polygon",
+			geometry: `{"type":"Polygon","coordinates":[` + square + `]}`,
+			meshes:   1,
+			area:     16,
+		},
+		{
+			name:     "polygon with hole",
+			geometry: `{"type":"Polygon","coordinates":[` + square + `,` + hole + `]}`,
+			meshes:   1,
+			area:     12,
+		},
+		{
+			name:     "concave polygon",
+			geometry: `{"type":"Polygon","coordinates":[` + lShape + `]}`,
+			meshes:   1,
+			area:     3,
+		},
+		{
+			name:       "extruded polygon with hole",
+			geometry:   `{"type":"Polygon","coordinates":[` + square + `,` + hole + `]}`,
+			properties: `{"height":"10","fill":"#0000ff"}`,
+			opts:       Options{HeightProperty: "height"},
+			meshes:     1,
+			area:       2*12 + 4*4*10 + 4*2*10,
+			volume:     12 * 10,
+			color:      &mgl32.Vec3{0, 0, 1},
+		},
+		{
+			name:       "polygon without height",
+			geometry:   `{"type":"MultiPolygon","coordinates":[[` + square + `],[` + lShape + `]]}`,
+			properties: `{"levels":3}`,
+			opts:       Options{HeightProperty: "height"},
+			meshes:     2,
+			area:       19,
+		},
+		{
+			name:     "collection",
+			geometry: `{"type":"GeometryCollection","geometries":[{"type":"Point","coordinates":[10,10]},{"type":"LineString","coordinates":[[10,10],[11,11]]}]}`,
+			points:   1,
+			lines:    1,
+		},
+		{
+			name:     "degenerated polygon",
+			geometry: `{"type":"Polygon","coordinates":[[[10,10],[11,11],[10,10]]]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			var g object
+			if err := json.Unmarshal([]byte(tt.geometry), &g); err != nil {
+				t.Fatal(err)
+			}
+			var props map[string]interface{}
+			if tt.properties != "" {
+				if err := json.Unmarshal([]byte(tt.properties), &props); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			tt.opts.Projected = true
+			b := &builder{opts: tt.opts, file: &rexfile.File{}, nextID: 1}
+			if err := b.geometry(g, props); err != nil {
+				t.Fatal(err)
+			}
+
+			var points int
+			for _, pl := range b.file.PointLists {
+				points += len(pl.Points)
+				if tt.color != nil && (len(pl.Colors) != len(pl.Points) || pl.Colors[0] != *tt.color) {
+					t.Errorf("got colors %v, want %v", pl.Colors, *tt.color)
+				}
+			}
+			if points != tt.points || len(b.file.LineSets) != tt.lines || len(b.file.Meshes) != tt.meshes {
+				t.Fatalf("got %d points, %d lines and %d meshes, want %d, %d and %d",
+					points, len(b.file.LineSets), len(b.file.Meshes), tt.points, tt.lines, tt.meshes)
+			}
+			for _, ls := range b.file.LineSets {
+				if tt.color != nil && ls.Colors != tt.color.Vec4(1) {
+					t.Errorf("line color is %v, want %v", ls.Colors, *tt.color)
+				}
+			}
+
+			var area, volume float64
+			for _, mesh := range b.file.Meshes {
+				a, v := measure(mesh)
+				area += a
+				volume += v
+				if tt.color == nil {
+					continue
+				}
+				if len(b.file.Materials) != 1 || b.file.Materials[0].ID != mesh.MaterialID || b.file.Materials[0].KdRgb != *tt.color {
+					t.Errorf("got materials %v, want %v", b.file.Materials, *tt.color)
+				}
+			}
+			if math.Abs(area-tt.area) > 1e-4 {
+				t.Errorf("area is %v, want %v", area, tt.area)
+			}
+			if math.Abs(volume-tt.volume) > 1e-4 {
+				t.Errorf("volume is %v, want %v", volume, tt.volume)
+			}
+		})
+	}
+}
+
+func TestNewGroup(t *testing.T) {
+
+	const data = `{"type":"FeatureCollection","features":[
+		{"type":"Feature","id":7,"properties":{"name":"square","use":"park"},
+		 "geometry":{"type":"Polygon","coordinates":[[[500010.5,5200010,300],[500014.5,5200010,300],[500014.5,5200014,300],[500010.5,5200014,300]]]}},
+		{"type":"Feature","id":"tree","properties":{},"geometry":{"type":"Point","coordinates":[500012.5,5200012,301]}},
+		{"type":"Feature","properties":{},"geometry":null}
+	]}`
+
+	dec := NewDecoderReader(strings.NewReader(data))
+	dec.SetOptions(Options{Projected: true})
+	group, err := dec.NewGroup("city")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if geo, ok := rex.GeoreferenceOf(group); !ok || geo.Origin != (mgl64.Vec3{500010, 5200010, 300}) {
+		t.Errorf("got georeference %v, want the floored first position", geo)
+	}
+	children := group.Children()
+	if len(children) != 2 {
+		t.Fatalf("%d features, want the two with geometry", len(children))
+	}
+	for i, name := range []string{"square", "tree"} {
+		if got := children[i].GetNode().Name(); got != name {
+			t.Errorf("feature %d is named %s, want %s", i, got, name)
+		}
+	}
+	// the feature is found from the nodes of the geometry
+	f, ok := FeatureOf(children[0].GetNode().Children()[0])
+	if !ok || f.ID != 7.0 || f.Properties["use"] != "park" {
+		t.Errorf("got feature %+v, want the properties of the square", f)
+	}
+}
+
+func TestNewGroupWGS84(t *testing.T) {
+
+	const data = `{"type":"LineString","coordinates":[[15.44,47.07],[15.45,47.07]]}`
+
+	tests := []struct {
+		name   string
+		origin *gps.Position
+		want   mgl32.Vec3 // of the second position
+	}{
+		{"first position", nil, mgl32.Vec3{759, 0, 0}},
+		{"given origin", &gps.Position{Lon: 15.45, Lat: 47.07}, mgl32.Vec3{0, 0, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			b := &builder{opts: Options{GeoOrigin: tt.origin}, file: &rexfile.File{}, nextID: 1}
+			var g object
+			if err := json.Unmarshal([]byte(data), &g); err != nil {
+				t.Fatal(err)
+			}
+			if err := b.geometry(g, nil); err != nil {
+				t.Fatal(err)
+			}
+			if p := b.file.LineSets[0].Points[1]; !p.ApproxEqualThreshold(tt.want, 2) {
+				t.Errorf("position is %v, want %v", p, tt.want)
+			}
+		})
+	}
+
+	// registered by the file extension, a single geometry becomes a feature
+	group, err := loader.Load(strings.NewReader(data), "line.geojson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(group.Children()) != 1 {
+		t.Errorf("%d features, want 1", len(group.Children()))
+	}
+}
+
+func TestNewGroupInvalid(t *testing.T) {
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"not json", "<xml/>"},
+		{"short position", `{"type":"Point","coordinates":[15]}`},
+		{"wrong nesting", `{"type":"Polygon","coordinates":[15,47]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewDecoderReader(strings.NewReader(tt.data)).NewGroup("invalid"); err == nil {
+				t.Errorf("no error")
+			}
+		})
+	}
+}
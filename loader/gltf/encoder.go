@@ -0,0 +1,538 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package gltf writes node trees as glTF 2.0 files, either as .gltf with a
+// separate .bin buffer or as single binary .glb file. The node hierarchy
+// with the local transformations is kept, meshes sharing their geometry and
+// material are written once.
+package gltf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+
+	"github.com/breiting/g3next/entity"
+	"github.com/breiting/g3next/loader/rex"
+	"github.com/breiting/g3next/mat"
+	"github.com/g3n/engine/core"
+	"github.com/g3n/engine/geometry"
+	"github.com/g3n/engine/graphic"
+	g3nmaterial "github.com/g3n/engine/material"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/roboticeyes/gorexfile/encoding/rexfile"
+)
+
+// defaultShininess is used for REX materials without Ns, the same as the
+// default of the standard material
+const defaultShininess = 30
+
+// Options control how the node tree is written
+type Options struct {
+	// Coordinates converts the scene into the y-up system required by glTF.
+	// If To equals From, as for the zero value, the scene is converted from
+	// From into rex.YUpRightHanded, i.e. the zero value converts REX data.
+	Coordinates rex.CoordinateConversion
+}
+
+// Encoder writes a node tree as glTF file
+type Encoder struct {
+	file    string
+	opts    Options
+	skipped []uint64
+}
+
+// NewEncoder prepares an encoder writing to the given file. Files with the
+// extension .glb are written as binary glTF, all others as JSON together
+// with a .bin file of the same name.
+func NewEncoder(file string) *Encoder {
+	return &Encoder{file: file}
+}
+
+// SetOptions sets the options used for writing
+func (enc *Encoder) SetOptions(opts Options) {
+	enc.opts = opts
+}
+
+// Skipped returns the IDs of the REX images which were not exported by the
+// last call of Encode. glTF supports PNG and JPEG textures only, raw images
+// are skipped.
+func (enc *Encoder) Skipped() []uint64 {
+	return enc.skipped
+}
+
+// Encode writes the children of the root node. The transformation of the
+// root node itself is not exported.
+func (enc *Encoder) Encode(root core.INode) error {
+
+	b := build(root, enc.opts)
+	enc.skipped = b.skipped
+	doc, bin := b.doc, b.bin.Bytes()
+
+	if strings.EqualFold(filepath.Ext(enc.file), ".glb") {
+		var buf bytes.Buffer
+		if err := writeGLB(&buf, doc, bin); err != nil {
+			return err
+		}
+		return writeFile(enc.file, buf.Bytes())
+	}
+
+	if len(bin) > 0 {
+		binName := strings.TrimSuffix(filepath.Base(enc.file), filepath.Ext(enc.file)) + ".bin"
+		doc.Buffers[0].URI = binName
+		if err := writeFile(filepath.Join(filepath.Dir(enc.file), binName), bin); err != nil {
+			return err
+		}
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Cannot encode glTF document: %v", err)
+	}
+	return writeFile(enc.file, data)
+}
+
+// WriteGLB writes the children of the root node as binary glTF
+func WriteGLB(w io.Writer, root core.INode, opts Options) error {
+	b := build(root, opts)
+	return writeGLB(w, b.doc, b.bin.Bytes())
+}
+
+func writeGLB(w io.Writer, doc *document, bin []byte) error {
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("Cannot encode glTF document: %v", err)
+	}
+
+	// chunks are aligned to 4 bytes, JSON with spaces and binary with zeros
+	for len(data)%4 != 0 {
+		data = append(data, ' ')
+	}
+	for len(bin)%4 != 0 {
+		bin = append(bin, 0)
+	}
+
+	length := 12 + 8 + len(data)
+	if len(bin) > 0 {
+		length += 8 + len(bin)
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, []uint32{0x46546C67, 2, uint32(length)})
+	binary.Write(&buf, binary.LittleEndian, []uint32{uint32(len(data)), 0x4E4F534A})
+	buf.Write(data)
+	if len(bin) > 0 {
+		binary.Write(&buf, binary.LittleEndian, []uint32{uint32(len(bin)), 0x004E4942})
+		buf.Write(bin)
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("Cannot write glTF data: %v", err)
+	}
+	return nil
+}
+
+func writeFile(name string, data []byte) error {
+	if err := ioutil.WriteFile(name, data, 0644); err != nil {
+		return fmt.Errorf("Cannot write file %s", name)
+	}
+	return nil
+}
+
+// build converts the node tree into the glTF document and its binary buffer
+func build(root core.INode, opts Options) *builder {
+
+	conv := opts.Coordinates
+	if conv.To == conv.From {
+		conv.To = rex.YUpRightHanded
+	}
+	m := mgl32.Mat3FromCols(
+		conv.Apply(mgl32.Vec3{1, 0, 0}),
+		conv.Apply(mgl32.Vec3{0, 1, 0}),
+		conv.Apply(mgl32.Vec3{0, 0, 1}),
+	)
+
+	b := &builder{
+		conv:   m,
+		mirror: m.Det() < 0,
+		doc: &document{
+			Asset:  asset{Version: "2.0", Generator: "g3next"},
+			Scenes: []scene{{Nodes: []int{}}},
+		},
+		meshes:    make(map[meshKey]int),
+		materials: make(map[g3nmaterial.IMaterial]int),
+		images:    make(map[*byte]int),
+	}
+
+	for _, child := range root.GetNode().Children() {
+		b.doc.Scenes[0].Nodes = append(b.doc.Scenes[0].Nodes, b.addNode(child))
+	}
+
+	if b.bin.Len() > 0 {
+		b.doc.Buffers = []buffer{{ByteLength: b.bin.Len()}}
+	}
+	return b
+}
+
+// meshKey identifies meshes which can be shared between nodes
+type meshKey struct {
+	geom *geometry.Geometry
+	mat  g3nmaterial.IMaterial
+	mode int
+}
+
+// builder keeps the state while walking the node tree
+type builder struct {
+	doc       *document
+	bin       bytes.Buffer
+	meshes    map[meshKey]int
+	materials map[g3nmaterial.IMaterial]int // -1 for the default material
+	images    map[*byte]int                 // by image data, shared between materials
+	skipped   []uint64                      // IDs of images which are not supported
+
+	conv   mgl32.Mat3 // coordinate conversion, a signed permutation of the axes
+	mirror bool       // the conversion changes the handedness
+}
+
+// addNode adds the node with all its children and returns its index
+func (b *builder) addNode(inode core.INode) int {
+
+	n := inode.GetNode()
+	idx := len(b.doc.Nodes)
+	b.doc.Nodes = append(b.doc.Nodes, node{})
+
+	gn := node{Name: n.Name()}
+	pos, quat, scale := b.transform(n)
+	if pos != (mgl32.Vec3{}) {
+		gn.Translation = (*[3]float32)(&pos)
+	}
+	if quat != mgl32.QuatIdent() {
+		gn.Rotation = &[4]float32{quat.X(), quat.Y(), quat.Z(), quat.W}
+	}
+	if scale != (mgl32.Vec3{1, 1, 1}) {
+		gn.Scale = (*[3]float32)(&scale)
+	}
+
+	if label, ok := inode.(*entity.Label); ok {
+		// glTF has no text, the graphic of the label is not exported
+		if gn.Name == "" {
+			gn.Name = label.Data.Text
+		}
+		gn.Extras = map[string]interface{}{"text": label.Data.Text}
+		b.doc.Nodes[idx] = gn
+		return idx
+	}
+
+	var g *graphic.Graphic
+	mode := modeTriangles
+	if m := rex.ToMesh(inode); m != nil {
+		g = m.GetGraphic()
+	} else {
+		switch gr := inode.(type) {
+		case *graphic.Points:
+			g, mode = gr.GetGraphic(), modePoints
+		case *graphic.LineStrip:
+			g, mode = gr.GetGraphic(), modeLineStrip
+		case *graphic.Lines:
+			g, mode = gr.GetGraphic(), modeLines
+		}
+	}
+	if g != nil {
+		if m, ok := b.mesh(g, mode); ok {
+			gn.Mesh = &m
+		}
+	}
+
+	for _, child := range n.Children() {
+		gn.Children = append(gn.Children, b.addNode(child))
+	}
+	b.doc.Nodes[idx] = gn
+	return idx
+}
+
+// transform returns the local transformation of the node in the converted
+// system, i.e. conjugated with the conversion
+func (b *builder) transform(n *core.Node) (mgl32.Vec3, mgl32.Quat, mgl32.Vec3) {
+
+	pos, quat, scale := n.Position(), n.Quaternion(), n.Scale()
+	t := b.conv.Mul3x1(mgl32.Vec3{pos.X, pos.Y, pos.Z})
+
+	// the rotation axis is a pseudo vector and flips when mirroring
+	axis := b.conv.Mul3x1(mgl32.Vec3{quat.X, quat.Y, quat.Z})
+	if b.mirror {
+		axis = axis.Mul(-1)
+	}
+	q := mgl32.Quat{W: quat.W, V: axis}
+
+	// the scale is only permuted
+	s := b.conv.Mul3x1(mgl32.Vec3{scale.X, scale.Y, scale.Z})
+	for i := range s {
+		s[i] = float32(math.Abs(float64(s[i])))
+	}
+	return t, q, s
+}
+
+// convert returns the vertex data in the converted system
+func (b *builder) convert(data rexfile.Mesh) rexfile.Mesh {
+
+	apply := func(vs []mgl32.Vec3) []mgl32.Vec3 {
+		r := make([]mgl32.Vec3, len(vs))
+		for i, v := range vs {
+			r[i] = b.conv.Mul3x1(v)
+		}
+		return r
+	}
+	data.Coords = apply(data.Coords)
+	data.Normals = apply(data.Normals)
+	if b.mirror {
+		triangles := make([]rexfile.Triangle, len(data.Triangles))
+		for i, t := range data.Triangles {
+			triangles[i] = rexfile.Triangle{V0: t.V0, V1: t.V2, V2: t.V1}
+		}
+		data.Triangles = triangles
+	}
+	return data
+}
+
+// mesh returns the index of the mesh for the graphic, it is created on first use
+func (b *builder) mesh(g *graphic.Graphic, mode int) (int, bool) {
+
+	imat := g.GetMaterial(0)
+	key := meshKey{geom: g.GetGeometry(), mat: imat, mode: mode}
+	if idx, ok := b.meshes[key]; ok {
+		return idx, true
+	}
+
+	data := b.convert(rex.MeshBlock(key.geom, 0, ""))
+	if len(data.Coords) == 0 {
+		return 0, false
+	}
+
+	p := primitive{
+		Attributes: map[string]int{"POSITION": b.addVec3(data.Coords, true, false)},
+		Mode:       mode,
+	}
+	if len(data.Normals) == len(data.Coords) && mode == modeTriangles {
+		p.Attributes["NORMAL"] = b.addVec3(data.Normals, false, true)
+	}
+	if len(data.TexCoords) == len(data.Coords) {
+		p.Attributes["TEXCOORD_0"] = b.addVec2(data.TexCoords)
+	}
+	if len(data.Colors) == len(data.Coords) {
+		p.Attributes["COLOR_0"] = b.addVec3(data.Colors, false, false)
+	}
+
+	var indices []uint32
+	switch {
+	case mode == modeTriangles:
+		for _, t := range data.Triangles {
+			indices = append(indices, t.V0, t.V1, t.V2)
+		}
+	case key.geom.Indexed():
+		indices = key.geom.Indices()
+	}
+	if len(indices) > 0 {
+		i := b.addIndices(indices)
+		p.Indices = &i
+	}
+
+	if m := b.material(imat); m >= 0 {
+		p.Material = &m
+	}
+
+	idx := len(b.doc.Meshes)
+	b.doc.Meshes = append(b.doc.Meshes, mesh{Name: g.Name(), Primitives: []primitive{p}})
+	b.meshes[key] = idx
+	return idx, true
+}
+
+// material returns the index of the glTF material, -1 if the default material
+// is used (e.g. for vertex colors). The Phong values of REX materials are
+// mapped to a dielectric material, the roughness is derived from the
+// shininess.
+func (b *builder) material(imat g3nmaterial.IMaterial) int {
+
+	if idx, ok := b.materials[imat]; ok {
+		return idx
+	}
+
+	var m material
+	switch std := imat.(type) {
+	case *mat.RexStandardMaterial:
+		data := std.Data
+		m.Name = fmt.Sprintf("material-%d", data.ID)
+		m.PbrMetallicRoughness = pbrMetallicRoughness{
+			BaseColorFactor: [4]float32{data.KdRgb.X(), data.KdRgb.Y(), data.KdRgb.Z(), data.Alpha},
+			RoughnessFactor: roughness(data.KsRgb, data.Ns),
+		}
+		if data.Alpha < 1 {
+			m.AlphaMode = "BLEND"
+		}
+		m.DoubleSided = std.Side() == g3nmaterial.SideDouble
+		if std.Texture != nil {
+			if tex, ok := b.texture(std.Texture); ok {
+				m.PbrMetallicRoughness.BaseColorTexture = &textureInfo{Index: tex}
+			}
+		}
+	case *g3nmaterial.Standard:
+		c := std.AmbientColor()
+		m.PbrMetallicRoughness = pbrMetallicRoughness{
+			BaseColorFactor: [4]float32{c.R, c.G, c.B, 1},
+			RoughnessFactor: 1,
+		}
+		m.DoubleSided = std.Side() == g3nmaterial.SideDouble
+	default:
+		b.materials[imat] = -1
+		return -1
+	}
+
+	idx := len(b.doc.Materials)
+	b.doc.Materials = append(b.doc.Materials, m)
+	b.materials[imat] = idx
+	return idx
+}
+
+// roughness converts the Phong shininess, materials without specular
+// highlights are completely rough
+func roughness(ks mgl32.Vec3, ns float32) float32 {
+
+	if ks.X() <= 0 && ks.Y() <= 0 && ks.Z() <= 0 {
+		return 1
+	}
+	if ns <= 0 {
+		ns = defaultShininess
+	}
+	return float32(math.Sqrt(2 / float64(ns+2)))
+}
+
+// texture returns the index of the texture for the image, the image is
+// embedded into the buffer on first use. Raw images are not supported.
+func (b *builder) texture(img *rexfile.Image) (int, bool) {
+
+	if len(img.Data) == 0 {
+		return 0, false
+	}
+	if idx, ok := b.images[&img.Data[0]]; ok {
+		return idx, true
+	}
+
+	var mimeType string
+	switch img.Compression {
+	case rexfile.Png:
+		mimeType = "image/png"
+	case rexfile.Jpeg:
+		mimeType = "image/jpeg"
+	default:
+		fmt.Println("WARNING: Skipping raw texture", img.ID)
+		b.skipped = append(b.skipped, img.ID)
+		return 0, false
+	}
+
+	if len(b.doc.Samplers) == 0 {
+		// linear filtering with mipmaps and repeat as for REX textures
+		b.doc.Samplers = append(b.doc.Samplers, sampler{MagFilter: 9729, MinFilter: 9987, WrapS: 10497, WrapT: 10497})
+	}
+	b.doc.Images = append(b.doc.Images, image{
+		BufferView: b.addView(img.Data, 0),
+		MimeType:   mimeType,
+	})
+	idx := len(b.doc.Textures)
+	b.doc.Textures = append(b.doc.Textures, texture{Sampler: 0, Source: len(b.doc.Images) - 1})
+	b.images[&img.Data[0]] = idx
+	return idx, true
+}
+
+// addView appends the data to the buffer and returns the index of its view
+func (b *builder) addView(data []byte, target int) int {
+
+	for b.bin.Len()%4 != 0 {
+		b.bin.WriteByte(0)
+	}
+	b.doc.BufferViews = append(b.doc.BufferViews, bufferView{
+		ByteOffset: b.bin.Len(),
+		ByteLength: len(data),
+		Target:     target,
+	})
+	b.bin.Write(data)
+	return len(b.doc.BufferViews) - 1
+}
+
+func (b *builder) addAccessor(a accessor) int {
+	b.doc.Accessors = append(b.doc.Accessors, a)
+	return len(b.doc.Accessors) - 1
+}
+
+// addVec3 adds the vectors as accessor, positions require the bounds and
+// normals must have unit length
+func (b *builder) addVec3(vs []mgl32.Vec3, bounds, normalize bool) int {
+
+	data := make([]byte, 0, len(vs)*12)
+	min := []float32{math.MaxFloat32, math.MaxFloat32, math.MaxFloat32}
+	max := []float32{-math.MaxFloat32, -math.MaxFloat32, -math.MaxFloat32}
+	for _, v := range vs {
+		if normalize && v.Len() > 0 {
+			v = v.Normalize()
+		}
+		for i := 0; i < 3; i++ {
+			data = appendFloat(data, v[i])
+			if v[i] < min[i] {
+				min[i] = v[i]
+			}
+			if v[i] > max[i] {
+				max[i] = v[i]
+			}
+		}
+	}
+
+	a := accessor{
+		BufferView:    b.addView(data, targetArrayBuffer),
+		ComponentType: componentFloat,
+		Count:         len(vs),
+		Type:          "VEC3",
+	}
+	if bounds {
+		a.Min, a.Max = min, max
+	}
+	return b.addAccessor(a)
+}
+
+func (b *builder) addVec2(vs []mgl32.Vec2) int {
+
+	data := make([]byte, 0, len(vs)*8)
+	for _, v := range vs {
+		data = appendFloat(data, v[0])
+		data = appendFloat(data, v[1])
+	}
+	return b.addAccessor(accessor{
+		BufferView:    b.addView(data, targetArrayBuffer),
+		ComponentType: componentFloat,
+		Count:         len(vs),
+		Type:          "VEC2",
+	})
+}
+
+func (b *builder) addIndices(indices []uint32) int {
+
+	data := make([]byte, len(indices)*4)
+	for i, idx := range indices {
+		binary.LittleEndian.PutUint32(data[i*4:], idx)
+	}
+	return b.addAccessor(accessor{
+		BufferView:    b.addView(data, targetElementArrayBuffer),
+		ComponentType: componentUint32,
+		Count:         len(indices),
+		Type:          "SCALAR",
+	})
+}
+
+func appendFloat(data []byte, f float32) []byte {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], math.Float32bits(f))
+	return append(data, buf[:]...)
+}
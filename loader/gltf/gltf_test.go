@@ -0,0 +1,301 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gltf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/breiting/g3next/loader/rex"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/roboticeyes/gorexfile/encoding/rexfile"
+)
+
+// readGLB checks the chunks of the binary file and returns its content
+func readGLB(t *testing.T, data []byte) (*document, []byte) {
+
+	t.Helper()
+	le := binary.LittleEndian
+	if len(data) < 20 || le.Uint32(data) != 0x46546C67 || le.Uint32(data[4:]) != 2 || int(le.Uint32(data[8:])) != len(data) {
+		t.Fatalf("invalid GLB header")
+	}
+	n := int(le.Uint32(data[12:]))
+	if le.Uint32(data[16:]) != 0x4E4F534A || 20+n > len(data) {
+		t.Fatalf("invalid JSON chunk")
+	}
+	var doc document
+	if err := json.Unmarshal(data[20:20+n], &doc); err != nil {
+		t.Fatal(err)
+	}
+	var bin []byte
+	if rest := data[20+n:]; len(rest) > 0 {
+		m := int(le.Uint32(rest))
+		if len(rest) < 8+m || le.Uint32(rest[4:]) != 0x004E4942 {
+			t.Fatalf("invalid BIN chunk")
+		}
+		bin = rest[8 : 8+m]
+	}
+	return &doc, bin
+}
+
+// vec3s returns the values of a float VEC3 accessor
+func vec3s(doc *document, bin []byte, idx int) []mgl32.Vec3 {
+
+	a := doc.Accessors[idx]
+	data := bin[doc.BufferViews[a.BufferView].ByteOffset:]
+	vs := make([]mgl32.Vec3, a.Count)
+	for i := range vs {
+		for k := 0; k < 3; k++ {
+			vs[i][k] = math.Float32frombits(binary.LittleEndian.Uint32(data[(i*3+k)*4:]))
+		}
+	}
+	return vs
+}
+
+// indices returns the values of an uint32 SCALAR accessor
+func indices(doc *document, bin []byte, idx int) []uint32 {
+
+	a := doc.Accessors[idx]
+	data := bin[doc.BufferViews[a.BufferView].ByteOffset:]
+	is := make([]uint32, a.Count)
+	for i := range is {
+		is[i] = binary.LittleEndian.Uint32(data[i*4:])
+	}
+	return is
+}
+
+// writeScene returns a cube placed twice, a point list, a line set and a
+// text as binary glTF
+func writeScene(t *testing.T, opts Options) (*document, []byte) {
+
+	t.Helper()
+	mesh, material := rexfile.NewCube(1, 2, 1)
+	material.KsRgb = mgl32.Vec3{1, 1, 1}
+	material.Ns = 30
+	a := rexfile.NewSceneNode(3, 1, "a")
+	a.Translation = mgl32.Vec3{1, 2, 3}
+	b := rexfile.NewSceneNode(4, 1, "b")
+	b.Translation = mgl32.Vec3{4, 5, 6}
+	file := &rexfile.File{
+		Meshes:     []rexfile.Mesh{mesh},
+		Materials:  []rexfile.Material{material},
+		SceneNodes: []rexfile.SceneNode{a, b},
+		PointLists: []rexfile.PointList{{ID: 5, Points: []mgl32.Vec3{{0, 0, 0}, {1, 1, 1}}}},
+		LineSets:   []rexfile.LineSet{{ID: 6, Colors: mgl32.Vec4{1, 0, 0, 1}, Points: []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}}}},
+		Texts:      []rexfile.Text{{ID: 7, Position: mgl32.Vec3{0, 0, 1}, Text: "label"}},
+	}
+	root, _, err := rex.CreateRexNodeOptions(file, "scene", rex.LoadOptions{LineMode: rex.LineSegments})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteGLB(&buf, root, opts); err != nil {
+		t.Fatal(err)
+	}
+	return readGLB(t, buf.Bytes())
+}
+
+// identity keeps the coordinates of the scene
+var identity = Options{Coordinates: rex.CoordinateConversion{From: rex.YUpRightHanded, To: rex.YUpRightHanded}}
+
+func TestEncode(t *testing.T) {
+
+	doc, bin := writeScene(t, identity)
+
+	modes := make(map[int]primitive)
+	for _, m := range doc.Meshes {
+		if len(m.Primitives) != 1 {
+			t.Fatalf("mesh %s has %d primitives, want 1", m.Name, len(m.Primitives))
+		}
+		modes[m.Primitives[0].Mode] = m.Primitives[0]
+	}
+	if len(doc.Meshes) != 3 || len(modes) != 3 {
+		t.Fatalf("got %d meshes, want the shared cube, the points and the lines", len(doc.Meshes))
+	}
+
+	cube, ok := modes[modeTriangles]
+	if !ok || cube.Indices == nil || cube.Material == nil {
+		t.Fatalf("got %+v, want an indexed cube with material", cube)
+	}
+	if n := len(indices(doc, bin, *cube.Indices)); n != 36 {
+		t.Errorf("%d indices, want 36", n)
+	}
+	positions := doc.Accessors[cube.Attributes["POSITION"]]
+	if len(positions.Min) != 3 || len(positions.Max) != 3 {
+		t.Errorf("positions have no bounds")
+	}
+	if _, ok := cube.Attributes["NORMAL"]; !ok {
+		t.Errorf("normals are missing")
+	}
+	pbr := doc.Materials[*cube.Material].PbrMetallicRoughness
+	if pbr.BaseColorFactor != [4]float32{0.9, 0.7, 0.1, 1} || !mgl32.FloatEqual(pbr.RoughnessFactor, 0.25) {
+		t.Errorf("got %+v, want the diffuse color and a roughness of 0.25", pbr)
+	}
+	if _, ok := modes[modePoints]; !ok {
+		t.Errorf("points are missing")
+	}
+	if lines, ok := modes[modeLines]; !ok || len(vec3s(doc, bin, lines.Attributes["POSITION"])) != 2 {
+		t.Errorf("got %+v, want a line segment", lines)
+	}
+
+	var placed []mgl32.Vec3
+	var label string
+	for _, n := range doc.Nodes {
+		if n.Mesh != nil && doc.Meshes[*n.Mesh].Primitives[0].Mode == modeTriangles && n.Translation != nil {
+			placed = append(placed, mgl32.Vec3(*n.Translation))
+		}
+		if s, ok := n.Extras["text"].(string); ok {
+			label = s
+		}
+	}
+	if len(placed) != 2 || placed[0] != (mgl32.Vec3{1, 2, 3}) || placed[1] != (mgl32.Vec3{4, 5, 6}) {
+		t.Errorf("cube is placed at %v, want both scene nodes", placed)
+	}
+	if label != "label" {
+		t.Errorf("text is %q, want the label", label)
+	}
+	if len(doc.Scenes) != 1 || len(doc.Buffers) != 1 || doc.Buffers[0].ByteLength != len(bin) {
+		t.Errorf("got %d scenes and buffers %+v", len(doc.Scenes), doc.Buffers)
+	}
+}
+
+func TestEncodeFile(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "gltf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	mesh, _ := rexfile.NewCube(1, uint64(rexfile.NotSpecified), 1)
+	root, _, err := rex.CreateRexNodeOptions(&rexfile.File{Meshes: []rexfile.Mesh{mesh}}, "cube", rex.LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		bin  string // name of the separate buffer
+	}{
+		{"cube.gltf", "cube.bin"},
+		{"cube.GLB", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			file := filepath.Join(dir, tt.name)
+			if err := NewEncoder(file).Encode(root); err != nil {
+				t.Fatal(err)
+			}
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.bin == "" {
+				readGLB(t, data)
+				return
+			}
+
+			var doc document
+			if err := json.Unmarshal(data, &doc); err != nil {
+				t.Fatal(err)
+			}
+			bin, err := ioutil.ReadFile(filepath.Join(dir, tt.bin))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(doc.Buffers) != 1 || doc.Buffers[0].URI != tt.bin || doc.Buffers[0].ByteLength != len(bin) {
+				t.Errorf("got buffers %+v, want %s with %d bytes", doc.Buffers, tt.bin, len(bin))
+			}
+		})
+	}
+}
+func TestEncodeCoordinates(t *testing.T) {
+
+	mesh, _ := rexfile.NewCube(1, uint64(rexfile.NotSpecified), 1)
+	sn := rexfile.NewSceneNode(2, 1, "placed")
+	sn.Translation = mgl32.Vec3{1, 2, 3}
+	q := mgl32.QuatRotate(0.5, mgl32.Vec3{0, 0, 1})
+	sn.Rotation = q.V.Vec4(q.W)
+	file := &rexfile.File{Meshes: []rexfile.Mesh{mesh}, SceneNodes: []rexfile.SceneNode{sn}}
+	root, _, err := rex.CreateRexNodeOptions(file, "cube", rex.LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		coordinates rex.CoordinateConversion
+		translation mgl32.Vec3
+		up          mgl32.Vec3 // rotation axis
+	}{
+		{"rex", rex.CoordinateConversion{}, mgl32.Vec3{1, 3, -2}, mgl32.Vec3{0, 1, 0}},
+		{"already y-up", rex.CoordinateConversion{From: rex.YUpRightHanded, To: rex.YUpRightHanded}, mgl32.Vec3{1, 2, 3}, mgl32.Vec3{0, 0, 1}},
+		{"left handed", rex.CoordinateConversion{From: rex.ZUpLeftHanded, To: rex.YUpRightHanded}, mgl32.Vec3{1, 3, 2}, mgl32.Vec3{0, -1, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			var buf bytes.Buffer
+			if err := WriteGLB(&buf, root, Options{Coordinates: tt.coordinates}); err != nil {
+				t.Fatal(err)
+			}
+			doc, bin := readGLB(t, buf.Bytes())
+			var placed *node
+			for i := range doc.Nodes {
+				if doc.Nodes[i].Mesh != nil {
+					placed = &doc.Nodes[i]
+				}
+			}
+			if placed == nil || placed.Translation == nil || placed.Rotation == nil {
+				t.Fatalf("got nodes %+v, want a placed mesh", doc.Nodes)
+			}
+			if got := mgl32.Vec3(*placed.Translation); !got.ApproxEqual(tt.translation) {
+				t.Errorf("translation is %v, want %v", got, tt.translation)
+			}
+			r := placed.Rotation
+			if axis := (mgl32.Vec3{r[0], r[1], r[2]}).Normalize(); !axis.ApproxEqualThreshold(tt.up, 1e-5) {
+				t.Errorf("rotation axis is %v, want %v", axis, tt.up)
+			}
+
+			// the faces of the cube must still point outward
+			p := doc.Meshes[*placed.Mesh].Primitives[0]
+			coords := vec3s(doc, bin, p.Attributes["POSITION"])
+			var center mgl32.Vec3
+			for _, v := range coords {
+				center = center.Add(v.Mul(1 / float32(len(coords))))
+			}
+			is := indices(doc, bin, *p.Indices)
+			for i := 0; i+2 < len(is); i += 3 {
+				v0, v1, v2 := coords[is[i]], coords[is[i+1]], coords[is[i+2]]
+				if n := v1.Sub(v0).Cross(v2.Sub(v0)); n.Dot(v0.Sub(center)) <= 0 {
+					t.Fatalf("triangle %v points inward", is[i:i+3])
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeSkippedTextures(t *testing.T) {
+
+	b := &builder{doc: &document{}, images: make(map[*byte]int)}
+	if _, ok := b.texture(&rexfile.Image{ID: 7, Compression: rexfile.Raw24, Data: []byte{255, 0, 0}}); ok {
+		t.Errorf("raw texture is exported")
+	}
+	if _, ok := b.texture(&rexfile.Image{ID: 8, Compression: rexfile.Png, Data: []byte{0x89, 'P', 'N', 'G'}}); !ok {
+		t.Errorf("png texture is not exported")
+	}
+	if len(b.skipped) != 1 || b.skipped[0] != 7 {
+		t.Errorf("skipped %v, want [7]", b.skipped)
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSVOptions describe the layout of a CSV file. Columns are given either by
+// their name in the header line or by their 0-based index. Elevation and
+// Time are optional and can be left empty.
+type CSVOptions struct {
+	Comma      rune   // field delimiter, ',' if 0
+	Header     bool   // the first line contains the column names
+	Lat        string // latitude in degrees
+	Lon        string // longitude in degrees
+	Elevation  string // elevation in meters
+	Time       string // time, either UNIX seconds or formatted with TimeLayout
+	TimeLayout string // layout of formatted times, time.RFC3339 if empty
+}
+
+// DefaultCSVOptions returns the options for a comma separated file with the
+// header columns lat, lon, ele and time
+func DefaultCSVOptions() CSVOptions {
+	return CSVOptions{
+		Comma:     ',',
+		Header:    true,
+		Lat:       "lat",
+		Lon:       "lon",
+		Elevation: "ele",
+		Time:      "time",
+	}
+}
+
+// ReadCSV reads all rows of the CSV file as one path. Optional columns which
+// are not part of the header are ignored.
+func ReadCSV(r io.Reader, opts CSVOptions) (Path, error) {
+
+	reader := csv.NewReader(r)
+	if opts.Comma != 0 {
+		reader.Comma = opts.Comma
+	}
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var header []string
+	if opts.Header {
+		var err error
+		if header, err = reader.Read(); err != nil {
+			return Path{}, fmt.Errorf("Cannot read CSV header: %v", err)
+		}
+	}
+
+	lat := column(opts.Lat, header)
+	lon := column(opts.Lon, header)
+	if lat < 0 || lon < 0 {
+		return Path{}, fmt.Errorf("Cannot find CSV columns %s and %s", opts.Lat, opts.Lon)
+	}
+	ele := column(opts.Elevation, header)
+	tim := column(opts.Time, header)
+
+	layout := opts.TimeLayout
+	if layout == "" {
+		layout = time.RFC3339
+	}
+
+	var path Path
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Path{}, fmt.Errorf("Cannot read CSV file: %v", err)
+		}
+
+		field := func(idx int) string {
+			if idx < 0 || idx >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[idx])
+		}
+
+		var pos Position
+		if pos.Lat, err = strconv.ParseFloat(field(lat), 64); err != nil {
+			return Path{}, fmt.Errorf("Cannot read CSV row %d: invalid latitude %s", row, field(lat))
+		}
+		if pos.Lon, err = strconv.ParseFloat(field(lon), 64); err != nil {
+			return Path{}, fmt.Errorf("Cannot read CSV row %d: invalid longitude %s", row, field(lon))
+		}
+		if s := field(ele); s != "" {
+			if pos.Elevation, err = strconv.ParseFloat(s, 64); err != nil {
+				return Path{}, fmt.Errorf("Cannot read CSV row %d: invalid elevation %s", row, s)
+			}
+		}
+		if s := field(tim); s != "" {
+			if pos.Time, err = parseTime(s, layout); err != nil {
+				return Path{}, fmt.Errorf("Cannot read CSV row %d: invalid time %s", row, s)
+			}
+		}
+		path.Positions = append(path.Positions, pos)
+	}
+	return path, nil
+}
+
+// column returns the index of the column given by name or index, -1 if not found
+func column(name string, header []string) int {
+
+	if name == "" {
+		return -1
+	}
+	for i, h := range header {
+		if strings.EqualFold(strings.TrimSpace(h), name) {
+			return i
+		}
+	}
+	if idx, err := strconv.Atoi(name); err == nil && idx >= 0 {
+		return idx
+	}
+	return -1
+}
+
+// parseTime accepts UNIX seconds (with fraction) or the given layout
+func parseTime(s, layout string) (time.Time, error) {
+
+	if secs, err := strconv.ParseFloat(s, 64); err == nil {
+		sec, frac := math.Modf(secs)
+		return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+	}
+	return time.Parse(layout, s)
+}
@@ -0,0 +1,188 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package gps imports GPS recordings from GPX and CSV files as REX tracks
+// and waypoints as REX point lists. The geographic WGS84 positions are
+// projected into a local metric frame (x east, y north, z up) with the origin
+// at a given position, so that the tracks can be used with
+// geom.NewRexTrackGeometry or a camera path mover.
+package gps
+
+import (
+	"math"
+	"time"
+
+	"github.com/breiting/g3next/loader/rex"
+	"github.com/g3n/engine/core"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/roboticeyes/gorexfile/encoding/rexfile"
+)
+
+// WGS84 ellipsoid
+const (
+	semiMajorAxis = 6378137.0
+	flattening    = 1 / 298.257223563
+	eccentricity2 = flattening * (2 - flattening)
+)
+
+// Position is a geographic WGS84 position
+type Position struct {
+	Lat       float64   // latitude in degrees
+	Lon       float64   // longitude in degrees
+	Elevation float64   // elevation in meters, 0 if unknown
+	Time      time.Time // zero if unknown
+}
+
+// Path is a sequence of recorded positions, e.g. a GPX track segment
+type Path struct {
+	Name      string
+	Positions []Position
+	Waypoints bool // the positions are unrelated points and are not connected
+}
+
+// Recording is attached as user data to the group created by NewGroup. It
+// keeps what cannot be stored in the REX blocks.
+type Recording struct {
+	Projection *Projection            // projection of the local coordinates
+	Times      map[uint64][]time.Time // time of every position by track or point list ID
+}
+
+// RecordingOf returns the recording of a group created by NewGroup
+func RecordingOf(inode core.INode) (*Recording, bool) {
+	rec, ok := inode.GetNode().UserData().(*Recording)
+	return rec, ok
+}
+
+// Projection converts geographic positions into a local east-north-up frame
+// tangent to the ellipsoid at the origin
+type Projection struct {
+	Origin Position
+
+	ecef     [3]float64
+	rotation [3][3]float64 // rows are the east, north and up axes in ECEF
+}
+
+// NewProjection creates a projection with the origin at the given position
+func NewProjection(origin Position) *Projection {
+
+	lat := origin.Lat * math.Pi / 180
+	lon := origin.Lon * math.Pi / 180
+	sinLat, cosLat := math.Sincos(lat)
+	sinLon, cosLon := math.Sincos(lon)
+
+	return &Projection{
+		Origin: origin,
+		ecef:   toECEF(origin),
+		rotation: [3][3]float64{
+			{-sinLon, cosLon, 0},
+			{-sinLat * cosLon, -sinLat * sinLon, cosLat},
+			{cosLat * cosLon, cosLat * sinLon, sinLat},
+		},
+	}
+}
+
+// Project returns the position in meters relative to the origin
+func (p *Projection) Project(pos Position) mgl32.Vec3 {
+
+	ecef := toECEF(pos)
+	d := [3]float64{ecef[0] - p.ecef[0], ecef[1] - p.ecef[1], ecef[2] - p.ecef[2]}
+
+	var v mgl32.Vec3
+	for i, axis := range p.rotation {
+		v[i] = float32(axis[0]*d[0] + axis[1]*d[1] + axis[2]*d[2])
+	}
+	return v
+}
+
+// Track converts the path into a REX track. REX only stores the time of the
+// track, which is taken from the first position with a time.
+func (p *Projection) Track(id uint64, path Path) rexfile.Track {
+
+	track := rexfile.Track{
+		ID:         id,
+		NrOfPoints: uint32(len(path.Positions)),
+	}
+	for _, pos := range path.Positions {
+		if track.Timestamp == 0 && !pos.Time.IsZero() {
+			track.Timestamp = pos.Time.Unix()
+		}
+		track.Points = append(track.Points, rexfile.TrackElement{Point: p.Project(pos)})
+	}
+	return track
+}
+
+// PointList converts the waypoints into a REX point list
+func (p *Projection) PointList(id uint64, path Path) rexfile.PointList {
+
+	pl := rexfile.PointList{ID: id}
+	for _, pos := range path.Positions {
+		pl.Points = append(pl.Points, p.Project(pos))
+	}
+	return pl
+}
+
+// Convert converts all paths with at least one position into REX tracks, and
+// waypoints into REX point lists, with consecutive IDs starting at 1. If
+// origin is nil, the first position is used.
+func Convert(paths []Path, origin *Position) (*rexfile.File, *Recording) {
+
+	rec := &Recording{Times: make(map[uint64][]time.Time)}
+	if origin != nil {
+		rec.Projection = NewProjection(*origin)
+	}
+
+	file := &rexfile.File{}
+	var id uint64
+	for _, path := range paths {
+		if len(path.Positions) == 0 {
+			continue
+		}
+		if rec.Projection == nil {
+			rec.Projection = NewProjection(path.Positions[0])
+		}
+		id++
+		if path.Waypoints {
+			file.PointLists = append(file.PointLists, rec.Projection.PointList(id, path))
+		} else {
+			file.Tracks = append(file.Tracks, rec.Projection.Track(id, path))
+		}
+		times := make([]time.Time, len(path.Positions))
+		for i, pos := range path.Positions {
+			times[i] = pos.Time
+		}
+		rec.Times[id] = times
+	}
+	return file, rec
+}
+
+// NewGroup converts the paths and returns a group containing the tracks as
+// line strips and the waypoints as points. The recording with the projection
+// and the times is attached as user data (see RecordingOf). If origin is nil,
+// the first position is used.
+func NewGroup(paths []Path, origin *Position, name string, opts rex.LoadOptions) (*core.Node, error) {
+
+	file, rec := Convert(paths, origin)
+	group, _, err := rex.CreateRexNodeOptions(file, name, opts)
+	if err != nil {
+		return nil, err
+	}
+	group.SetUserData(rec)
+	return group, nil
+}
+
+func toECEF(pos Position) [3]float64 {
+
+	lat := pos.Lat * math.Pi / 180
+	lon := pos.Lon * math.Pi / 180
+	sinLat, cosLat := math.Sincos(lat)
+	sinLon, cosLon := math.Sincos(lon)
+
+	// radius of curvature in the prime vertical
+	n := semiMajorAxis / math.Sqrt(1-eccentricity2*sinLat*sinLat)
+	return [3]float64{
+		(n + pos.Elevation) * cosLat * cosLon,
+		(n + pos.Elevation) * cosLat * sinLon,
+		(n*(1-eccentricity2) + pos.Elevation) * sinLat,
+	}
+}
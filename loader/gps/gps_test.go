@@ -0,0 +1,226 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/breiting/g3next/loader"
+	"github.com/breiting/g3next/loader/rex"
+	"github.com/g3n/engine/graphic"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const gpxData = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1">
+  <wpt lat="47.0700" lon="15.4400"><name>start</name></wpt>
+  <wpt lat="47.0800" lon="15.4500"><ele>400</ele></wpt>
+  <rte>
+    <name>route</name>
+    <rtept lat="47.07" lon="15.44"/>
+    <rtept lat="47.08" lon="15.44"/>
+  </rte>
+  <trk>
+    <name>walk</name>
+    <trkseg>
+      <trkpt lat="47.07" lon="15.44"><ele>350</ele><time>2020-05-01T10:00:00Z</time></trkpt>
+      <trkpt lat="47.07" lon="15.45"><ele>352</ele><time>2020-05-01T10:01:00Z</time></trkpt>
+      <trkpt lat="47.08" lon="15.45"><ele>360</ele><time>2020-05-01T10:02:30Z</time></trkpt>
+    </trkseg>
+    <trkseg>
+      <trkpt lat="47.08" lon="15.45"/>
+    </trkseg>
+  </trk>
+</gpx>`
+
+func TestProjection(t *testing.T) {
+
+	origin := Position{Lat: 47.07, Lon: 15.44, Elevation: 350}
+	proj := NewProjection(origin)
+
+	// one degree of latitude is about 111.2 km, one degree of longitude
+	// shrinks with the cosine of the latitude
+	tests := []struct {
+		name string
+		pos  Position
+		want mgl32.Vec3
+		tol  float32
+	}{
+		{"origin", origin, mgl32.Vec3{}, 1e-3},
+		{"up", Position{Lat: 47.07, Lon: 15.44, Elevation: 360}, mgl32.Vec3{0, 0, 10}, 1e-3},
+		{"north", Position{Lat: 47.08, Lon: 15.44, Elevation: 350}, mgl32.Vec3{0, 1112, 0}, 2},
+		{"east", Position{Lat: 47.07, Lon: 15.45, Elevation: 350}, mgl32.Vec3{759, 0, 0}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := proj.Project(tt.pos)
+			for i := 0; i < 3; i++ {
+				if math.Abs(float64(got[i]-tt.want[i])) > float64(tt.tol) {
+					t.Errorf("got %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestReadGPX(t *testing.T) {
+
+	paths, err := ReadGPX(strings.NewReader(gpxData))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		positions int
+		waypoints bool
+	}{
+		{"walk", 3, false},
+		{"walk", 1, false},
+		{"route", 2, false},
+		{"waypoints", 2, true},
+	}
+	if len(paths) != len(tests) {
+		t.Fatalf("%d paths, want %d", len(paths), len(tests))
+	}
+	for i, tt := range tests {
+		p := paths[i]
+		if p.Name != tt.name || len(p.Positions) != tt.positions || p.Waypoints != tt.waypoints {
+			t.Errorf("path %d is %s with %d positions (waypoints %v), want %s with %d (%v)",
+				i, p.Name, len(p.Positions), p.Waypoints, tt.name, tt.positions, tt.waypoints)
+		}
+	}
+	if pos := paths[0].Positions[2]; pos.Elevation != 360 || !pos.Time.Equal(time.Date(2020, 5, 1, 10, 2, 30, 0, time.UTC)) {
+		t.Errorf("got %+v, want the third track point", pos)
+	}
+
+	if _, err := ReadGPX(strings.NewReader(`<gpx><trk><trkseg><trkpt lat="1" lon="2"><time>noon</time></trkpt></trkseg></trk></gpx>`)); err == nil {
+		t.Errorf("no error for an invalid time")
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		data  string
+		opts  CSVOptions
+		want  []Position
+		error bool
+	}{
+		{
+			name: "default",
+			data: "lat,lon,ele,time\n47.07,15.44,350,2020-05-01T10:00:00Z\n47.08, 15.45,,\n",
+			opts: DefaultCSVOptions(),
+			want: []Position{
+				{Lat: 47.07, Lon: 15.44, Elevation: 350, Time: time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)},
+				{Lat: 47.08, Lon: 15.45},
+			},
+		},
+		{
+			name: "columns by index and unix time",
+			data: "1588327200.5;15.44;47.07\n",
+			opts: CSVOptions{Comma: ';', Lat: "2", Lon: "1", Time: "0"},
+			want: []Position{{Lat: 47.07, Lon: 15.44, Time: time.Unix(1588327200, 5e8)}},
+		},
+		{
+			name: "custom layout without optional columns",
+			data: "Latitude,Longitude,Date\n47.07,15.44,01.05.2020 10:00\n",
+			opts: CSVOptions{Header: true, Lat: "latitude", Lon: "longitude", Elevation: "ele", Time: "date", TimeLayout: "02.01.2006 15:04"},
+			want: []Position{{Lat: 47.07, Lon: 15.44, Time: time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)}},
+		},
+		{
+			name:  "missing column",
+			data:  "x,y\n1,2\n",
+			opts:  DefaultCSVOptions(),
+			error: true,
+		},
+		{
+			name:  "invalid latitude",
+			data:  "lat,lon\nnorth,15.44\n",
+			opts:  DefaultCSVOptions(),
+			error: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			path, err := ReadCSV(strings.NewReader(tt.data), tt.opts)
+			if tt.error {
+				if err == nil {
+					t.Errorf("no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(path.Positions) != len(tt.want) {
+				t.Fatalf("%d positions, want %d", len(path.Positions), len(tt.want))
+			}
+			for i, want := range tt.want {
+				got := path.Positions[i]
+				if got.Lat != want.Lat || got.Lon != want.Lon || got.Elevation != want.Elevation || !got.Time.Equal(want.Time) {
+					t.Errorf("position %d is %+v, want %+v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewGroup(t *testing.T) {
+
+	paths, err := ReadGPX(strings.NewReader(gpxData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	group, err := NewGroup(paths, nil, "walk", rex.LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lines, points int
+	for _, child := range group.Children() {
+		switch child.(type) {
+		case *graphic.LineStrip:
+			lines++
+		case *graphic.Points:
+			points++
+		}
+	}
+	if lines != 3 || points != 1 {
+		t.Errorf("got %d line strips and %d points, want 3 tracks and the waypoints", lines, points)
+	}
+
+	rec, ok := RecordingOf(group)
+	if !ok {
+		t.Fatal("no recording attached")
+	}
+	if rec.Projection.Origin != paths[0].Positions[0] {
+		t.Errorf("origin is %+v, want the first position", rec.Projection.Origin)
+	}
+	times := rec.Times[1]
+	if len(times) != 3 || times[2].Sub(times[0]) != 150*time.Second {
+		t.Errorf("got times %v, want the times of the track points", times)
+	}
+	if len(rec.Times[4]) != 2 {
+		t.Errorf("got times %v, want one per waypoint", rec.Times[4])
+	}
+
+	// registered by the file extension
+	group, err = loader.Load(strings.NewReader(gpxData), "walk.gpx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := RecordingOf(group); !ok || len(group.Children()) != 4 {
+		t.Errorf("got %d nodes, want 4 with a recording", len(group.Children()))
+	}
+}
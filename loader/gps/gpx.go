@@ -0,0 +1,82 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+type gpxFile struct {
+	Waypoints []gpxPoint `xml:"wpt"`
+	Routes    []struct {
+		Name   string     `xml:"name"`
+		Points []gpxPoint `xml:"rtept"`
+	} `xml:"rte"`
+	Tracks []struct {
+		Name     string `xml:"name"`
+		Segments []struct {
+			Points []gpxPoint `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+type gpxPoint struct {
+	Lat       float64 `xml:"lat,attr"`
+	Lon       float64 `xml:"lon,attr"`
+	Elevation float64 `xml:"ele"`
+	Time      string  `xml:"time"`
+}
+
+// ReadGPX reads all tracks, routes and waypoints of the GPX file. Every track
+// segment and every route becomes a path, all waypoints together form one
+// path named "waypoints" which is marked as Waypoints.
+func ReadGPX(r io.Reader) ([]Path, error) {
+
+	var gpx gpxFile
+	if err := xml.NewDecoder(r).Decode(&gpx); err != nil {
+		return nil, fmt.Errorf("Cannot read GPX file: %v", err)
+	}
+
+	var paths []Path
+	add := func(name string, points []gpxPoint, waypoints bool) error {
+		path := Path{Name: name, Waypoints: waypoints}
+		for _, pt := range points {
+			pos := Position{Lat: pt.Lat, Lon: pt.Lon, Elevation: pt.Elevation}
+			if s := strings.TrimSpace(pt.Time); s != "" {
+				t, err := time.Parse(time.RFC3339, s)
+				if err != nil {
+					return fmt.Errorf("Cannot read GPX time %s", s)
+				}
+				pos.Time = t
+			}
+			path.Positions = append(path.Positions, pos)
+		}
+		paths = append(paths, path)
+		return nil
+	}
+
+	for _, trk := range gpx.Tracks {
+		for _, seg := range trk.Segments {
+			if err := add(trk.Name, seg.Points, false); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, rte := range gpx.Routes {
+		if err := add(rte.Name, rte.Points, false); err != nil {
+			return nil, err
+		}
+	}
+	if len(gpx.Waypoints) > 0 {
+		if err := add("waypoints", gpx.Waypoints, true); err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
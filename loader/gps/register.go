@@ -0,0 +1,28 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"io"
+
+	"github.com/breiting/g3next/loader"
+	"github.com/breiting/g3next/loader/rex"
+	"github.com/g3n/engine/core"
+)
+
+func init() {
+	// GPX files start with a generic XML declaration, CSV files need options
+	loader.Register(loader.Format{
+		Name:       "GPX",
+		Extensions: []string{".gpx"},
+		Load: func(r io.Reader, name string) (*core.Node, error) {
+			paths, err := ReadGPX(r)
+			if err != nil {
+				return nil, err
+			}
+			return NewGroup(paths, nil, name, rex.LoadOptions{})
+		},
+	})
+}
@@ -0,0 +1,50 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package writer contains helpers shared by the encoders of the loader
+// packages.
+package writer
+
+import (
+	"fmt"
+	"io"
+)
+
+// ErrWriter keeps the first write error, all following writes are skipped.
+// This allows writing text formats line by line and checking the error once.
+type ErrWriter struct {
+	w      io.Writer
+	format string
+	err    error
+}
+
+// New creates a writer, errors name the given format, e.g. "OBJ"
+func New(w io.Writer, format string) *ErrWriter {
+	return &ErrWriter{w: w, format: format}
+}
+
+// Printf writes the formatted text
+func (ew *ErrWriter) Printf(format string, args ...interface{}) {
+	if ew.err != nil {
+		return
+	}
+	if _, err := fmt.Fprintf(ew.w, format, args...); err != nil {
+		ew.err = fmt.Errorf("Cannot write %s data: %v", ew.format, err)
+	}
+}
+
+// Write writes the data
+func (ew *ErrWriter) Write(b []byte) {
+	if ew.err != nil {
+		return
+	}
+	if _, err := ew.w.Write(b); err != nil {
+		ew.err = fmt.Errorf("Cannot write %s data: %v", ew.format, err)
+	}
+}
+
+// Err returns the first write error
+func (ew *ErrWriter) Err() error {
+	return ew.err
+}
@@ -0,0 +1,58 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package writer
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// limitWriter fails after n bytes
+type limitWriter struct {
+	bytes.Buffer
+	n int
+}
+
+func (w *limitWriter) Write(b []byte) (int, error) {
+	if w.Len()+len(b) > w.n {
+		return 0, errors.New("disk full")
+	}
+	return w.Buffer.Write(b)
+}
+
+func TestErrWriter(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		limit int
+		want  string
+		err   string
+	}{
+		{"success", 100, "a 1\nbc", ""},
+		{"printf fails", 2, "", "Cannot write TEST data: disk full"},
+		{"write fails", 5, "a 1\n", "Cannot write TEST data: disk full"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			w := &limitWriter{n: tt.limit}
+			ew := New(w, "TEST")
+			ew.Printf("a %d\n", 1)
+			ew.Write([]byte("bc"))
+			// skipped after an error
+			ew.Printf("")
+
+			if w.String() != tt.want {
+				t.Errorf("wrote %q, want %q", w.String(), tt.want)
+			}
+			err := ew.Err()
+			if (err == nil) != (tt.err == "") || err != nil && err.Error() != tt.err {
+				t.Errorf("error is %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package las
+
+import (
+	"github.com/breiting/g3next/geom"
+	"github.com/g3n/engine/geometry"
+	"github.com/g3n/engine/gls"
+	"github.com/g3n/engine/math32"
+)
+
+// Names of the custom vertex attributes, e.g. for coloring by intensity in
+// a custom shader
+const (
+	AttribIntensity      = "VertexIntensity"
+	AttribClassification = "VertexClassification"
+)
+
+// NewPointGeometry returns the geometry of the point cloud, the same as
+// geom.NewRexPointGeometry with intensity and classification as additional
+// attributes
+func NewPointGeometry(cloud *PointCloud) *geometry.Geometry {
+
+	g := geom.NewRexPointGeometry(cloud.Points)
+	addAttributes(g, cloud)
+	return g
+}
+
+func addAttributes(g *geometry.Geometry, cloud *PointCloud) {
+
+	if len(cloud.Intensity) == len(cloud.Points.Points) {
+		intensity := math32.NewArrayF32(len(cloud.Intensity), len(cloud.Intensity))
+		for i, v := range cloud.Intensity {
+			intensity[i] = float32(v)
+		}
+		g.AddVBO(gls.NewVBO(intensity).AddCustomAttrib(AttribIntensity, 1))
+	}
+
+	if len(cloud.Classification) == len(cloud.Points.Points) {
+		classification := math32.NewArrayF32(len(cloud.Classification), len(cloud.Classification))
+		for i, v := range cloud.Classification {
+			classification[i] = float32(v)
+		}
+		g.AddVBO(gls.NewVBO(classification).AddCustomAttrib(AttribClassification, 1))
+	}
+}
@@ -0,0 +1,313 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package las reads point clouds from LAS 1.2 to 1.4 files. The point data
+// formats 0 to 3 and 6 to 8 are supported, compressed LAZ files are not.
+package las
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/breiting/g3next/loader/rex"
+	"github.com/g3n/engine/core"
+	"github.com/g3n/engine/graphic"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/roboticeyes/gorexfile/encoding/rexfile"
+)
+
+const (
+	headerSize12 = 227 // size of the public header of LAS 1.2
+	headerSize14 = 375 // size of the public header of LAS 1.4
+)
+
+// Header contains the relevant fields of the public header block
+type Header struct {
+	VersionMajor   uint8
+	VersionMinor   uint8
+	SystemID       string
+	Software       string
+	HeaderSize     uint16
+	PointOffset    uint32 // offset to the point data
+	PointFormat    uint8
+	RecordLength   uint16
+	NumberOfPoints uint64
+	Scale          mgl64.Vec3
+	Offset         mgl64.Vec3
+	Min            mgl64.Vec3
+	Max            mgl64.Vec3
+}
+
+// Bounds is an axis aligned box in the coordinates of the file
+type Bounds struct {
+	Min mgl64.Vec3
+	Max mgl64.Vec3
+}
+
+// Contains reports whether the point is inside the box (including the border)
+func (b Bounds) Contains(p mgl64.Vec3) bool {
+	for i := 0; i < 3; i++ {
+		if p[i] < b.Min[i] || p[i] > b.Max[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Options control which points are read and how the scene graph is built
+type Options struct {
+	rex.LoadOptions
+
+	// Decimation keeps only every n-th point, all points are kept if <= 1
+	Decimation int
+
+	// Bounds keeps only the points inside the box, all points if nil
+	Bounds *Bounds
+}
+
+// PointCloud is the content of a LAS file. The points are relative to the
+// origin, colors and attributes have the same order as the points.
+type PointCloud struct {
+	Header         Header
+	Origin         mgl64.Vec3
+	Points         rexfile.PointList
+	Intensity      []uint16
+	Classification []uint8
+}
+
+// Decoder is the LAS file decoder
+type Decoder struct {
+	r      io.Reader
+	closer io.Closer
+	opts   Options
+}
+
+// NewDecoder opens the LAS file, it is closed after decoding
+func NewDecoder(lasFile string) (*Decoder, error) {
+
+	file, err := os.Open(lasFile)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot open file %s", lasFile)
+	}
+	return &Decoder{r: file, closer: file}, nil
+}
+
+// NewDecoderReader creates a decoder with a reader
+func NewDecoderReader(r io.Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+// SetOptions sets the options used for reading and building the scene graph
+func (dec *Decoder) SetOptions(opts Options) {
+	dec.opts = opts
+}
+
+// NewGroup decodes the LAS file and returns a group containing the points.
+// The georeference of the group contains the origin of the local coordinates.
+// Intensity and classification are added to the geometry as custom
+// attributes (see AttribIntensity and AttribClassification).
+func (dec *Decoder) NewGroup(name string) (*core.Node, error) {
+
+	cloud, err := dec.Decode()
+	if err != nil {
+		return nil, err
+	}
+
+	// the points are already relative to the origin
+	opts := dec.opts.LoadOptions
+	opts.Origin = nil
+	opts.LocalOrigin = false
+
+	file := &rexfile.File{PointLists: []rexfile.PointList{cloud.Points}}
+	group, _, err := rex.CreateRexNodeOptions(file, name, opts)
+	if err != nil {
+		return nil, err
+	}
+	group.SetUserData(&rex.Georeference{Origin: cloud.Origin})
+	for _, child := range group.Children() {
+		if points, ok := child.(*graphic.Points); ok {
+			addAttributes(points.GetGeometry(), cloud)
+		}
+	}
+	return group, nil
+}
+
+// Decode reads the header and all points passing the decimation and bounds
+// filter. The origin is taken from the options or else from the minimum of
+// the header, floored to full meters.
+func (dec *Decoder) Decode() (*PointCloud, error) {
+
+	if dec.closer != nil {
+		defer dec.closer.Close()
+	}
+
+	br := bufio.NewReaderSize(dec.r, 1<<20)
+	hdr, err := readHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	cloud := &PointCloud{Header: *hdr, Points: rexfile.PointList{ID: 1}}
+	if dec.opts.Origin != nil {
+		cloud.Origin = *dec.opts.Origin
+	} else {
+		for i := 0; i < 3; i++ {
+			cloud.Origin[i] = math.Floor(hdr.Min[i])
+		}
+	}
+
+	// skip the variable length records
+	if skip := int64(hdr.PointOffset) - int64(hdr.HeaderSize); skip > 0 {
+		if _, err := io.CopyN(ioutil.Discard, br, skip); err != nil {
+			return nil, fmt.Errorf("Cannot read LAS variable length records: %v", err)
+		}
+	}
+
+	layout := formats[hdr.PointFormat]
+	step := uint64(1)
+	if dec.opts.Decimation > 1 {
+		step = uint64(dec.opts.Decimation)
+	}
+
+	var colors [][3]uint16
+	var maxColor uint16
+	record := make([]byte, hdr.RecordLength)
+	for i := uint64(0); i < hdr.NumberOfPoints; i++ {
+		if _, err := io.ReadFull(br, record); err != nil {
+			return nil, fmt.Errorf("Cannot read LAS point %d: %v", i, err)
+		}
+		if i%step != 0 {
+			continue
+		}
+
+		var p mgl64.Vec3
+		for k := 0; k < 3; k++ {
+			raw := int32(binary.LittleEndian.Uint32(record[k*4:]))
+			p[k] = float64(raw)*hdr.Scale[k] + hdr.Offset[k]
+		}
+		if dec.opts.Bounds != nil && !dec.opts.Bounds.Contains(p) {
+			continue
+		}
+
+		local := p.Sub(cloud.Origin)
+		cloud.Points.Points = append(cloud.Points.Points, mgl32.Vec3{float32(local[0]), float32(local[1]), float32(local[2])})
+		cloud.Intensity = append(cloud.Intensity, binary.LittleEndian.Uint16(record[12:]))
+		class := record[layout.classification]
+		if hdr.PointFormat < 6 {
+			// the upper bits are flags in the legacy formats
+			class &= 0x1f
+		}
+		cloud.Classification = append(cloud.Classification, class)
+
+		if layout.rgb > 0 {
+			var c [3]uint16
+			for k := 0; k < 3; k++ {
+				c[k] = binary.LittleEndian.Uint16(record[layout.rgb+k*2:])
+				if c[k] > maxColor {
+					maxColor = c[k]
+				}
+			}
+			colors = append(colors, c)
+		}
+	}
+
+	// many files store 8 bit colors although 16 bits are defined
+	scale := float32(65535)
+	if maxColor <= 255 {
+		scale = 255
+	}
+	for _, c := range colors {
+		cloud.Points.Colors = append(cloud.Points.Colors, mgl32.Vec3{
+			float32(c[0]) / scale,
+			float32(c[1]) / scale,
+			float32(c[2]) / scale,
+		})
+	}
+	return cloud, nil
+}
+
+// pointFormat describes the byte offsets within a point record, rgb is 0 if
+// the format has no colors
+type pointFormat struct {
+	size           int
+	classification int
+	rgb            int
+}
+
+var formats = map[uint8]pointFormat{
+	0: {size: 20, classification: 15},
+	1: {size: 28, classification: 15},
+	2: {size: 26, classification: 15, rgb: 20},
+	3: {size: 34, classification: 15, rgb: 28},
+	6: {size: 30, classification: 16},
+	7: {size: 36, classification: 16, rgb: 30},
+	8: {size: 38, classification: 16, rgb: 30},
+}
+
+func readHeader(r io.Reader) (*Header, error) {
+
+	buf := make([]byte, headerSize12)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, fmt.Errorf("Cannot read LAS header: %v", err)
+	}
+	if string(buf[0:4]) != "LASF" {
+		return nil, fmt.Errorf("Cannot read LAS header: not a LAS file")
+	}
+
+	le := binary.LittleEndian
+	float := func(offset int) float64 {
+		return math.Float64frombits(le.Uint64(buf[offset:]))
+	}
+	hdr := &Header{
+		VersionMajor:   buf[24],
+		VersionMinor:   buf[25],
+		SystemID:       strings.TrimRight(string(buf[26:58]), "\x00 "),
+		Software:       strings.TrimRight(string(buf[58:90]), "\x00 "),
+		HeaderSize:     le.Uint16(buf[94:]),
+		PointOffset:    le.Uint32(buf[96:]),
+		PointFormat:    buf[104],
+		RecordLength:   le.Uint16(buf[105:]),
+		NumberOfPoints: uint64(le.Uint32(buf[107:])),
+		Scale:          mgl64.Vec3{float(131), float(139), float(147)},
+		Offset:         mgl64.Vec3{float(155), float(163), float(171)},
+		Max:            mgl64.Vec3{float(179), float(195), float(211)},
+		Min:            mgl64.Vec3{float(187), float(203), float(219)},
+	}
+
+	if hdr.VersionMajor != 1 || hdr.VersionMinor < 2 || hdr.VersionMinor > 4 {
+		return nil, fmt.Errorf("Unsupported LAS version %d.%d", hdr.VersionMajor, hdr.VersionMinor)
+	}
+	if hdr.HeaderSize < headerSize12 {
+		return nil, fmt.Errorf("Cannot read LAS header: invalid header size %d", hdr.HeaderSize)
+	}
+	if hdr.PointFormat&0xc0 != 0 {
+		return nil, fmt.Errorf("Unsupported compressed LAS file")
+	}
+	format, ok := formats[hdr.PointFormat]
+	if !ok {
+		return nil, fmt.Errorf("Unsupported LAS point format %d", hdr.PointFormat)
+	}
+	if int(hdr.RecordLength) < format.size {
+		return nil, fmt.Errorf("Cannot read LAS header: invalid record length %d", hdr.RecordLength)
+	}
+
+	// read the rest of the header, LAS 1.4 has a 64 bit point count
+	rest := make([]byte, int(hdr.HeaderSize)-headerSize12)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, fmt.Errorf("Cannot read LAS header: %v", err)
+	}
+	if hdr.VersionMinor >= 4 && hdr.HeaderSize >= headerSize14 {
+		if n := le.Uint64(rest[247-headerSize12:]); n > 0 {
+			hdr.NumberOfPoints = n
+		}
+	}
+	return hdr, nil
+}
@@ -0,0 +1,250 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package las
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/breiting/g3next/loader"
+	"github.com/breiting/g3next/loader/rex"
+	"github.com/g3n/engine/graphic"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+// point is a record of the test files in file coordinates
+type point struct {
+	pos       mgl64.Vec3
+	intensity uint16
+	class     uint8
+	rgb       [3]uint16
+}
+
+var testPoints = []point{
+	{mgl64.Vec3{1000.5, 2000.25, 300}, 10, 2, [3]uint16{255, 0, 0}},
+	{mgl64.Vec3{1001.5, 2001.25, 301}, 20, 2 | 0x40, [3]uint16{0, 255, 0}},
+	{mgl64.Vec3{1002.5, 2002.25, 302}, 30, 6, [3]uint16{0, 0, 255}},
+	{mgl64.Vec3{1003.5, 2003.25, 303}, 40, 9, [3]uint16{255, 255, 255}},
+}
+
+// lasFile returns a LAS file with the points, vlr is the size of the
+// variable length records which are skipped
+func lasFile(minor, format uint8, points []point, rgbScale uint16, vlr int) []byte {
+
+	headerSize := headerSize12
+	if minor >= 4 {
+		headerSize = headerSize14
+	}
+	layout := formats[format&0x3f]
+	recordLength := layout.size + 2 // extra bytes are allowed
+
+	le := binary.LittleEndian
+	hdr := make([]byte, headerSize)
+	copy(hdr, "LASF")
+	hdr[24], hdr[25] = 1, minor
+	copy(hdr[26:], "test")
+	le.PutUint16(hdr[94:], uint16(headerSize))
+	le.PutUint32(hdr[96:], uint32(headerSize+vlr))
+	hdr[104] = format
+	le.PutUint16(hdr[105:], uint16(recordLength))
+	if minor >= 4 {
+		le.PutUint64(hdr[247:], uint64(len(points)))
+	} else {
+		le.PutUint32(hdr[107:], uint32(len(points)))
+	}
+	float := func(offset int, f float64) {
+		le.PutUint64(hdr[offset:], math.Float64bits(f))
+	}
+	scale := mgl64.Vec3{0.01, 0.01, 0.01}
+	offset := mgl64.Vec3{1000, 2000, 0}
+	for k := 0; k < 3; k++ {
+		float(131+k*8, scale[k])
+		float(155+k*8, offset[k])
+		float(179+k*16, points[len(points)-1].pos[k])
+		float(187+k*16, points[0].pos[k])
+	}
+
+	var buf bytes.Buffer
+	buf.Write(hdr)
+	buf.Write(make([]byte, vlr))
+	for _, p := range points {
+		record := make([]byte, recordLength)
+		for k := 0; k < 3; k++ {
+			le.PutUint32(record[k*4:], uint32(int32(math.Round((p.pos[k]-offset[k])/scale[k]))))
+		}
+		le.PutUint16(record[12:], p.intensity)
+		record[layout.classification] = p.class
+		if layout.rgb > 0 {
+			for k := 0; k < 3; k++ {
+				le.PutUint16(record[layout.rgb+k*2:], p.rgb[k]*rgbScale)
+			}
+		}
+		buf.Write(record)
+	}
+	return buf.Bytes()
+}
+
+func TestDecode(t *testing.T) {
+
+	origin := mgl64.Vec3{1000, 2000, 300}
+	tests := []struct {
+		name    string
+		data    []byte
+		opts    Options
+		indices []int // of the expected test points
+		colors  bool
+		classes []uint8
+	}{
+		{
+			name:    "format 0",
+			data:    lasFile(2, 0, testPoints, 1, 0),
+			indices: []int{0, 1, 2, 3},
+			classes: []uint8{2, 2, 6, 9},
+		},
+		{
+			name:    "format 2 with 8 bit colors and records",
+			data:    lasFile(2, 2, testPoints, 1, 54),
+			indices: []int{0, 1, 2, 3},
+			colors:  true,
+		},
+		{
+			name:    "format 3 with 16 bit colors",
+			data:    lasFile(3, 3, testPoints, 257, 0),
+			indices: []int{0, 1, 2, 3},
+			colors:  true,
+		},
+		{
+			name:    "LAS 1.4 format 7",
+			data:    lasFile(4, 7, testPoints, 257, 0),
+			indices: []int{0, 1, 2, 3},
+			colors:  true,
+			classes: []uint8{2, 2 | 0x40, 6, 9},
+		},
+		{
+			name:    "decimation",
+			data:    lasFile(2, 0, testPoints, 1, 0),
+			opts:    Options{Decimation: 2},
+			indices: []int{0, 2},
+		},
+		{
+			name:    "bounds",
+			data:    lasFile(2, 0, testPoints, 1, 0),
+			opts:    Options{Bounds: &Bounds{Min: mgl64.Vec3{1001, 2001, 0}, Max: mgl64.Vec3{1003, 2003, 400}}},
+			indices: []int{1, 2},
+		},
+		{
+			name:    "origin",
+			data:    lasFile(2, 0, testPoints, 1, 0),
+			opts:    Options{LoadOptions: rex.LoadOptions{Origin: &mgl64.Vec3{1001, 2001, 301}}},
+			indices: []int{0, 1, 2, 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			dec := NewDecoderReader(bytes.NewReader(tt.data))
+			dec.SetOptions(tt.opts)
+			cloud, err := dec.Decode()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := origin
+			if tt.opts.Origin != nil {
+				want = *tt.opts.Origin
+			}
+			if cloud.Origin != want {
+				t.Errorf("origin is %v, want %v", cloud.Origin, want)
+			}
+			points := cloud.Points.Points
+			if len(points) != len(tt.indices) || len(cloud.Intensity) != len(points) || len(cloud.Classification) != len(points) {
+				t.Fatalf("%d points, %d intensities and %d classes, want %d",
+					len(points), len(cloud.Intensity), len(cloud.Classification), len(tt.indices))
+			}
+			for i, idx := range tt.indices {
+				p := testPoints[idx]
+				local := p.pos.Sub(cloud.Origin)
+				if !points[i].ApproxEqualThreshold(mgl32.Vec3{float32(local[0]), float32(local[1]), float32(local[2])}, 1e-4) {
+					t.Errorf("point %d is %v, want %v", i, points[i], local)
+				}
+				if cloud.Intensity[i] != p.intensity {
+					t.Errorf("intensity %d is %d, want %d", i, cloud.Intensity[i], p.intensity)
+				}
+			}
+			if tt.classes != nil {
+				for i, c := range tt.classes {
+					if cloud.Classification[i] != c {
+						t.Errorf("class %d is %d, want %d", i, cloud.Classification[i], c)
+					}
+				}
+			}
+			if got := len(cloud.Points.Colors) == len(points); got != tt.colors {
+				t.Fatalf("%d colors for %d points", len(cloud.Points.Colors), len(points))
+			}
+			if tt.colors && cloud.Points.Colors[0] != (mgl32.Vec3{1, 0, 0}) {
+				t.Errorf("color is %v, want red", cloud.Points.Colors[0])
+			}
+		})
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+
+	valid := lasFile(2, 0, testPoints, 1, 0)
+	modified := func(offset int, b byte) []byte {
+		data := append([]byte(nil), valid...)
+		data[offset] = b
+		return data
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"not las", modified(0, 'X')},
+		{"version 1.1", modified(25, 1)},
+		{"compressed", modified(104, 0x80)},
+		{"unknown format", modified(104, 4)},
+		{"short records", modified(105, 10)},
+		{"truncated points", valid[:len(valid)-5]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewDecoderReader(bytes.NewReader(tt.data)).Decode(); err == nil {
+				t.Errorf("no error")
+			}
+		})
+	}
+}
+
+func TestNewGroup(t *testing.T) {
+
+	group, err := loader.Load(bytes.NewReader(lasFile(2, 2, testPoints, 1, 0)), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if geo, ok := rex.GeoreferenceOf(group); !ok || geo.Origin != (mgl64.Vec3{1000, 2000, 300}) {
+		t.Errorf("got georeference %v, want the origin", geo)
+	}
+	children := group.Children()
+	if len(children) != 1 {
+		t.Fatalf("%d nodes, want the points", len(children))
+	}
+	points, ok := children[0].(*graphic.Points)
+	if !ok {
+		t.Fatalf("got %T, want points", children[0])
+	}
+	for _, attrib := range []string{AttribIntensity, AttribClassification} {
+		if points.GetGeometry().VBOName(attrib) == nil {
+			t.Errorf("attribute %s is missing", attrib)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package las
+
+import (
+	"io"
+
+	"github.com/breiting/g3next/loader"
+	"github.com/g3n/engine/core"
+)
+
+func init() {
+	loader.Register(loader.Format{
+		Name:       "LAS",
+		Extensions: []string{".las"},
+		Magic:      []string{"LASF"},
+		Load: func(r io.Reader, name string) (*core.Node, error) {
+			return NewDecoderReader(r).NewGroup(name)
+		},
+	})
+}
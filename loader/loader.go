@@ -0,0 +1,117 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package loader provides a single entry point for loading files of all
+// registered formats. The format packages register themselves, therefore
+// they have to be imported, e.g.
+//
+//	import _ "github.com/breiting/g3next/loader/rex"
+package loader
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/g3n/engine/core"
+)
+
+// ErrUnknownFormat is returned if no registered format matches the file
+var ErrUnknownFormat = errors.New("unknown format")
+
+// LoadFunc loads the file from the reader into a new group with the given name
+type LoadFunc func(r io.Reader, name string) (*core.Node, error)
+
+// Format describes a file format which can be loaded
+type Format struct {
+	Name       string   // name of the format, e.g. "REX"
+	Extensions []string // file extensions including the dot, e.g. ".rex"
+	Magic      []string // prefixes identifying the file content, e.g. "REX1"
+	Load       LoadFunc
+}
+
+var (
+	formatsMu sync.RWMutex
+	formats   []Format
+)
+
+// Register makes a format available for Load. It is usually called in the
+// init function of the format package.
+func Register(f Format) {
+	formatsMu.Lock()
+	formats = append(formats, f)
+	formatsMu.Unlock()
+}
+
+// Formats returns all registered formats
+func Formats() []Format {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	return append([]Format(nil), formats...)
+}
+
+// Load detects the format of the file and loads it with the registered
+// loader. The format is taken from the first bytes of the content. If they
+// do not match any format, the extension of hint (a file name or path) is
+// used. The name of the returned group is the base name of hint without
+// extension.
+func Load(r io.Reader, hint string) (*core.Node, error) {
+
+	br := bufio.NewReader(r)
+	f, ok := detect(br, hint)
+	if !ok {
+		return nil, fmt.Errorf("Cannot load %s: %w", hint, ErrUnknownFormat)
+	}
+
+	name := strings.ToLower(f.Name)
+	if hint != "" {
+		name = strings.TrimSuffix(filepath.Base(hint), filepath.Ext(hint))
+	}
+	return f.Load(br, name)
+}
+
+// detect returns the format matching the content, the longest magic wins,
+// otherwise the format matching the extension of the hint
+func detect(br *bufio.Reader, hint string) (Format, bool) {
+
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+
+	var found Format
+	longest := 0
+	for _, f := range formats {
+		for _, magic := range f.Magic {
+			if len(magic) <= longest {
+				continue
+			}
+			// a short file returns an error together with the available bytes
+			head, _ := br.Peek(len(magic))
+			if bytes.Equal(head, []byte(magic)) {
+				found = f
+				longest = len(magic)
+			}
+		}
+	}
+	if longest > 0 {
+		return found, true
+	}
+
+	ext := strings.ToLower(filepath.Ext(hint))
+	if ext == "" {
+		return found, false
+	}
+	for _, f := range formats {
+		for _, e := range f.Extensions {
+			if strings.ToLower(e) == ext {
+				return f, true
+			}
+		}
+	}
+	return found, false
+}
@@ -0,0 +1,254 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package obj
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/breiting/g3next/loader/internal/writer"
+	"github.com/breiting/g3next/loader/rex"
+	"github.com/g3n/engine/core"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/roboticeyes/gorexfile/encoding/rexfile"
+)
+
+// Encoder writes a node tree as OBJ file together with an MTL file and the
+// texture images in the same directory
+type Encoder struct {
+	objFile string
+}
+
+// NewEncoder prepares an encoder writing to the given OBJ file. The MTL file
+// gets the same name with the extension .mtl.
+func NewEncoder(objFile string) *Encoder {
+	return &Encoder{objFile: objFile}
+}
+
+// Encode writes the node tree with all its children. The world transforms are
+// baked into the coordinates, the transformation of the root node itself is
+// not exported (see rex.CreateRexFile).
+func (enc *Encoder) Encode(root core.INode) error {
+
+	file := rex.CreateRexFile(root)
+
+	dir := filepath.Dir(enc.objFile)
+	base := strings.TrimSuffix(filepath.Base(enc.objFile), filepath.Ext(enc.objFile))
+	mtlName := base + ".mtl"
+
+	textures := make(map[uint64]string)
+	for _, img := range file.Images {
+		name, err := writeTexture(dir, base, img)
+		if err != nil {
+			return err
+		}
+		textures[img.ID] = name
+	}
+
+	if len(file.Materials) > 0 {
+		if err := writeFile(filepath.Join(dir, mtlName), func(w io.Writer) error {
+			return WriteMTL(w, file, textures)
+		}); err != nil {
+			return err
+		}
+	} else {
+		mtlName = ""
+	}
+
+	return writeFile(enc.objFile, func(w io.Writer) error {
+		return WriteOBJ(w, file, mtlName)
+	})
+}
+
+func writeFile(name string, write func(w io.Writer) error) error {
+
+	f, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("Cannot create file %s", name)
+	}
+	w := bufio.NewWriter(f)
+	if err := write(w); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("Cannot write file %s: %v", name, err)
+	}
+	return f.Close()
+}
+
+// writeTexture writes the image data as it is and returns the file name
+func writeTexture(dir, base string, img rexfile.Image) (string, error) {
+
+	var ext string
+	switch img.Compression {
+	case rexfile.Png:
+		ext = ".png"
+	case rexfile.Jpeg:
+		ext = ".jpg"
+	default:
+		fmt.Println("WARNING: Skipping raw texture", img.ID)
+		return "", nil
+	}
+
+	name := fmt.Sprintf("%s-texture-%d%s", base, img.ID, ext)
+	if err := ioutil.WriteFile(filepath.Join(dir, name), img.Data, 0644); err != nil {
+		return "", fmt.Errorf("Cannot write texture %s", name)
+	}
+	return name, nil
+}
+
+// WriteMTL writes the materials of the REX file. textures contains the file
+// names of the images by image ID.
+func WriteMTL(w io.Writer, file *rexfile.File, textures map[uint64]string) error {
+
+	ew := writer.New(w, "OBJ")
+	for _, m := range file.Materials {
+		ew.Printf("newmtl %s\n", materialName(m.ID))
+		ew.Printf("Ka %g %g %g\n", m.KaRgb.X(), m.KaRgb.Y(), m.KaRgb.Z())
+		ew.Printf("Kd %g %g %g\n", m.KdRgb.X(), m.KdRgb.Y(), m.KdRgb.Z())
+		ew.Printf("Ks %g %g %g\n", m.KsRgb.X(), m.KsRgb.Y(), m.KsRgb.Z())
+		ew.Printf("Ns %g\n", m.Ns)
+		ew.Printf("d %g\n", m.Alpha)
+		if name := textures[m.KdTextureID]; name != "" {
+			ew.Printf("map_Kd %s\n", name)
+		}
+		ew.Printf("\n")
+	}
+	return ew.Err()
+}
+
+// WriteOBJ writes meshes, point lists, line sets and tracks of the REX file.
+// Meshes placed by scene nodes are written once per scene node with the
+// transformation baked in. mtlName is referenced as material library if not empty.
+func WriteOBJ(w io.Writer, file *rexfile.File, mtlName string) error {
+
+	ew := writer.New(w, "OBJ")
+	if mtlName != "" {
+		ew.Printf("mtllib %s\n", mtlName)
+	}
+
+	// indices in OBJ are global and start with 1
+	var nv, nvt, nvn int
+
+	for _, mesh := range rex.BakeSceneNodes(file) {
+		ew.Printf("o %s\n", objectName(mesh.Name, "mesh", mesh.ID))
+		if mesh.MaterialID != rexfile.NotSpecified {
+			ew.Printf("usemtl %s\n", materialName(mesh.MaterialID))
+		}
+
+		// vertex colors use the common extension v x y z r g b
+		hasColors := len(mesh.Colors) == len(mesh.Coords)
+		for i, v := range mesh.Coords {
+			if hasColors {
+				c := mesh.Colors[i]
+				ew.Printf("v %g %g %g %g %g %g\n", v.X(), v.Y(), v.Z(), c.X(), c.Y(), c.Z())
+			} else {
+				ew.Printf("v %g %g %g\n", v.X(), v.Y(), v.Z())
+			}
+		}
+		hasTexCoords := len(mesh.TexCoords) == len(mesh.Coords)
+		if hasTexCoords {
+			for _, t := range mesh.TexCoords {
+				ew.Printf("vt %g %g\n", t.X(), t.Y())
+			}
+		}
+		hasNormals := len(mesh.Normals) == len(mesh.Coords)
+		if hasNormals {
+			for _, n := range mesh.Normals {
+				ew.Printf("vn %g %g %g\n", n.X(), n.Y(), n.Z())
+			}
+		}
+
+		corner := func(i uint32) string {
+			v := fmt.Sprint(nv + int(i) + 1)
+			switch {
+			case hasTexCoords && hasNormals:
+				return fmt.Sprintf("%s/%d/%d", v, nvt+int(i)+1, nvn+int(i)+1)
+			case hasTexCoords:
+				return fmt.Sprintf("%s/%d", v, nvt+int(i)+1)
+			case hasNormals:
+				return fmt.Sprintf("%s//%d", v, nvn+int(i)+1)
+			}
+			return v
+		}
+		for _, t := range mesh.Triangles {
+			ew.Printf("f %s %s %s\n", corner(t.V0), corner(t.V1), corner(t.V2))
+		}
+
+		nv += len(mesh.Coords)
+		if hasTexCoords {
+			nvt += len(mesh.TexCoords)
+		}
+		if hasNormals {
+			nvn += len(mesh.Normals)
+		}
+	}
+
+	for _, pl := range file.PointLists {
+		ew.Printf("o %s\n", objectName("", "pointlist", pl.ID))
+		hasColors := len(pl.Colors) == len(pl.Points)
+		for i, v := range pl.Points {
+			if hasColors {
+				c := pl.Colors[i]
+				ew.Printf("v %g %g %g %g %g %g\n", v.X(), v.Y(), v.Z(), c.X(), c.Y(), c.Z())
+			} else {
+				ew.Printf("v %g %g %g\n", v.X(), v.Y(), v.Z())
+			}
+		}
+		ew.Printf("p%s\n", indexList(nv, len(pl.Points)))
+		nv += len(pl.Points)
+	}
+
+	writeLine := func(kind string, id uint64, points []mgl32.Vec3) {
+		if len(points) < 2 {
+			return
+		}
+		ew.Printf("o %s\n", objectName("", kind, id))
+		for _, v := range points {
+			ew.Printf("v %g %g %g\n", v.X(), v.Y(), v.Z())
+		}
+		ew.Printf("l%s\n", indexList(nv, len(points)))
+		nv += len(points)
+	}
+	for _, ls := range file.LineSets {
+		writeLine("lineset", ls.ID, ls.Points)
+	}
+	for _, track := range file.Tracks {
+		var points []mgl32.Vec3
+		for _, p := range track.Points {
+			points = append(points, p.Point)
+		}
+		writeLine("track", track.ID, points)
+	}
+
+	return ew.Err()
+}
+
+func materialName(id uint64) string {
+	return fmt.Sprintf("material-%d", id)
+}
+
+func objectName(name, kind string, id uint64) string {
+	if name != "" {
+		return name
+	}
+	return fmt.Sprintf("%s-%d", kind, id)
+}
+
+// indexList returns the 1-based indices following the given offset
+func indexList(offset, n int) string {
+	var sb strings.Builder
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&sb, " %d", offset+i)
+	}
+	return sb.String()
+}
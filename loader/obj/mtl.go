@@ -0,0 +1,129 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package obj
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/roboticeyes/gorexfile/encoding/rexfile"
+)
+
+// loadMaterials reads the MTL file and adds its materials and textures as
+// REX datablocks. Missing files are reported but do not stop loading.
+func (p *parser) loadMaterials(lib string) {
+
+	if p.dec.dir == "" {
+		fmt.Println("WARNING: Cannot load material library without directory:", lib)
+		return
+	}
+
+	f, err := os.Open(filepath.Join(p.dec.dir, lib))
+	if err != nil {
+		fmt.Println("WARNING: Cannot open material library:", lib)
+		return
+	}
+	defer f.Close()
+
+	var mat *rexfile.Material
+	add := func() {
+		if mat != nil {
+			p.file.Materials = append(p.file.Materials, *mat)
+		}
+	}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		args := fields[1:]
+
+		if fields[0] == "newmtl" {
+			add()
+			m := rexfile.NewMaterial(p.newID())
+			mat = &m
+			p.materials[strings.Join(args, " ")] = m.ID
+			continue
+		}
+		if mat == nil {
+			continue
+		}
+
+		switch fields[0] {
+		case "Kd":
+			if v, err := parseFloats(args, 3); err == nil {
+				mat.KdRgb = mgl32.Vec3{v[0], v[1], v[2]}
+			}
+		case "Ka":
+			if v, err := parseFloats(args, 3); err == nil {
+				mat.KaRgb = mgl32.Vec3{v[0], v[1], v[2]}
+			}
+		case "Ks":
+			if v, err := parseFloats(args, 3); err == nil {
+				mat.KsRgb = mgl32.Vec3{v[0], v[1], v[2]}
+			}
+		case "Ns":
+			if v, err := parseFloats(args, 1); err == nil {
+				mat.Ns = v[0]
+			}
+		case "d":
+			// the value comes last, e.g. after -halo
+			if len(args) == 0 {
+				continue
+			}
+			if v, err := parseFloats(args[len(args)-1:], 1); err == nil {
+				mat.Alpha = v[0]
+			}
+		case "Tr":
+			if v, err := parseFloats(args, 1); err == nil {
+				mat.Alpha = 1 - v[0]
+			}
+		case "map_Kd":
+			// options like -s or -o are not supported, the file name comes last
+			if len(args) > 0 {
+				mat.KdTextureID = p.loadTexture(args[len(args)-1])
+			}
+		}
+	}
+	add()
+}
+
+// loadTexture adds the image file as REX image datablock and returns its ID
+func (p *parser) loadTexture(name string) uint64 {
+
+	data, err := ioutil.ReadFile(filepath.Join(p.dec.dir, filepath.FromSlash(name)))
+	if err != nil {
+		fmt.Println("WARNING: Cannot open texture:", name)
+		return rexfile.NotSpecified
+	}
+
+	_, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		fmt.Println("WARNING: Cannot decode texture:", name)
+		return rexfile.NotSpecified
+	}
+
+	img := rexfile.Image{ID: p.newID(), Data: data}
+	switch format {
+	case "jpeg":
+		img.Compression = rexfile.Jpeg
+	case "png":
+		img.Compression = rexfile.Png
+	default:
+		fmt.Println("WARNING: Unsupported texture format:", name)
+		return rexfile.NotSpecified
+	}
+	p.file.Images = append(p.file.Images, img)
+	return img.ID
+}
@@ -0,0 +1,307 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package obj imports Wavefront OBJ files with their MTL materials. The
+// content is converted into REX data blocks and built by the REX loader, so
+// that OBJ objects get the same entities, shading and metadata as REX objects.
+package obj
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/breiting/g3next/geom"
+	"github.com/breiting/g3next/loader/rex"
+	"github.com/g3n/engine/core"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/roboticeyes/gorexfile/encoding/rexfile"
+)
+
+// Decoder is the OBJ file decoder
+type Decoder struct {
+	r    io.Reader
+	dir  string // directory of MTL and texture files, empty if not available
+	opts rex.LoadOptions
+}
+
+// NewDecoder reads the OBJ file. MTL files and textures are searched in
+// the directory of the file.
+func NewDecoder(objFile string) (*Decoder, error) {
+
+	data, err := ioutil.ReadFile(objFile)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot open file %s", objFile)
+	}
+	return &Decoder{r: bytes.NewReader(data), dir: filepath.Dir(objFile)}, nil
+}
+
+// NewDecoderReader creates a decoder with a reader. MTL files can only be
+// loaded after setting the directory with SetDir.
+func NewDecoderReader(r io.Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+// SetDir sets the directory where MTL files and textures are searched
+func (dec *Decoder) SetDir(dir string) {
+	dec.dir = dir
+}
+
+// SetOptions sets the options used for building the scene graph
+func (dec *Decoder) SetOptions(opts rex.LoadOptions) {
+	dec.opts = opts
+}
+
+// NewGroup decodes the OBJ file and returns a group containing the meshes.
+// Every object, group and material change results in a separate mesh.
+func (dec *Decoder) NewGroup(name string) (*core.Node, error) {
+
+	file, err := dec.Decode()
+	if err != nil {
+		return nil, err
+	}
+	group, _, err := rex.CreateRexNodeOptions(file, name, dec.opts)
+	return group, err
+}
+
+// Decode reads the OBJ file and converts it into REX data blocks
+func (dec *Decoder) Decode() (*rexfile.File, error) {
+
+	p := &parser{
+		dec:       dec,
+		file:      &rexfile.File{},
+		nextID:    1,
+		materials: make(map[string]uint64),
+	}
+	if err := p.parse(dec.r); err != nil {
+		return nil, err
+	}
+	p.flush()
+	return p.file, nil
+}
+
+// corner is a face corner referencing position, texture coordinate and normal (0-based, -1 if missing)
+type corner [3]int
+
+// parser keeps the state while reading the OBJ statements
+type parser struct {
+	dec    *Decoder
+	file   *rexfile.File
+	nextID uint64
+
+	positions []mgl32.Vec3
+	colors    []mgl32.Vec3 // vertex colors, only complete if every vertex has one
+	texCoords []mgl32.Vec2
+	normals   []mgl32.Vec3
+
+	materials map[string]uint64 // material IDs by name
+
+	name     string // current object or group
+	material string // current material
+	faces    [][]corner
+}
+
+func (p *parser) newID() uint64 {
+	id := p.nextID
+	p.nextID++
+	return id
+}
+
+func (p *parser) parse(r io.Reader) error {
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if err := p.statement(fields[0], fields[1:]); err != nil {
+			return fmt.Errorf("Cannot read OBJ line %d: %v", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("Cannot read OBJ file: %v", err)
+	}
+	return nil
+}
+
+func (p *parser) statement(keyword string, args []string) error {
+
+	switch keyword {
+	case "v":
+		v, err := parseFloats(args, 3)
+		if err != nil {
+			return err
+		}
+		p.positions = append(p.positions, mgl32.Vec3{v[0], v[1], v[2]})
+		// vertex colors are an extension with r g b after x y z
+		if len(v) >= 6 {
+			p.colors = append(p.colors, mgl32.Vec3{v[3], v[4], v[5]})
+		}
+	case "vt":
+		v, err := parseFloats(args, 1)
+		if err != nil {
+			return err
+		}
+		v = append(v, 0)
+		p.texCoords = append(p.texCoords, mgl32.Vec2{v[0], v[1]})
+	case "vn":
+		v, err := parseFloats(args, 3)
+		if err != nil {
+			return err
+		}
+		p.normals = append(p.normals, mgl32.Vec3{v[0], v[1], v[2]})
+	case "f":
+		return p.face(args)
+	case "o", "g":
+		p.flush()
+		p.name = strings.Join(args, " ")
+	case "usemtl":
+		p.flush()
+		p.material = strings.Join(args, " ")
+	case "mtllib":
+		for _, lib := range args {
+			p.loadMaterials(lib)
+		}
+	}
+	// other statements (s, l, p, ...) are ignored
+	return nil
+}
+
+// face reads the corners of a face, polygons are triangulated when flushing
+func (p *parser) face(args []string) error {
+
+	if len(args) < 3 {
+		return fmt.Errorf("face with %d vertices", len(args))
+	}
+
+	face := make([]corner, len(args))
+	for i, arg := range args {
+		c := corner{-1, -1, -1}
+		counts := []int{len(p.positions), len(p.texCoords), len(p.normals)}
+		for j, s := range strings.Split(arg, "/") {
+			if j > 2 || s == "" {
+				continue
+			}
+			idx, err := strconv.Atoi(s)
+			if err != nil {
+				return fmt.Errorf("invalid index %s", s)
+			}
+			// negative indices are relative to the end of the list
+			if idx < 0 {
+				idx += counts[j]
+			} else {
+				idx--
+			}
+			if idx < 0 || idx >= counts[j] {
+				return fmt.Errorf("index %s out of range", s)
+			}
+			c[j] = idx
+		}
+		if c[0] < 0 {
+			return fmt.Errorf("face without vertex index")
+		}
+		face[i] = c
+	}
+	p.faces = append(p.faces, face)
+	return nil
+}
+
+// flush converts the faces read so far into a mesh datablock
+func (p *parser) flush() {
+
+	if len(p.faces) == 0 {
+		return
+	}
+
+	mesh := rexfile.Mesh{
+		ID:         p.newID(),
+		Name:       p.name,
+		MaterialID: rexfile.NotSpecified,
+	}
+	if id, ok := p.materials[p.material]; ok {
+		mesh.MaterialID = id
+	}
+
+	hasTexCoords, hasNormals := true, true
+	for _, face := range p.faces {
+		for _, c := range face {
+			hasTexCoords = hasTexCoords && c[1] >= 0
+			hasNormals = hasNormals && c[2] >= 0
+		}
+	}
+	hasColors := len(p.colors) == len(p.positions)
+
+	// every distinct corner becomes a vertex
+	vertices := make(map[corner]uint32)
+	vertex := func(c corner) uint32 {
+		if !hasTexCoords {
+			c[1] = -1
+		}
+		if !hasNormals {
+			c[2] = -1
+		}
+		if idx, ok := vertices[c]; ok {
+			return idx
+		}
+		idx := uint32(len(mesh.Coords))
+		vertices[c] = idx
+		mesh.Coords = append(mesh.Coords, p.positions[c[0]])
+		if hasColors {
+			mesh.Colors = append(mesh.Colors, p.colors[c[0]])
+		}
+		if hasTexCoords {
+			mesh.TexCoords = append(mesh.TexCoords, p.texCoords[c[1]])
+		}
+		if hasNormals {
+			mesh.Normals = append(mesh.Normals, p.normals[c[2]])
+		}
+		return idx
+	}
+
+	// polygons may be concave, they are triangulated by ear clipping
+	for _, face := range p.faces {
+		triangles := [][3]int{{0, 1, 2}}
+		if len(face) > 3 {
+			corners := make([]mgl32.Vec3, len(face))
+			for i, c := range face {
+				corners[i] = p.positions[c[0]]
+			}
+			triangles = geom.TriangulatePolygon(corners)
+		}
+		for _, t := range triangles {
+			mesh.Triangles = append(mesh.Triangles, rexfile.Triangle{
+				V0: vertex(face[t[0]]),
+				V1: vertex(face[t[1]]),
+				V2: vertex(face[t[2]]),
+			})
+		}
+	}
+
+	p.file.Meshes = append(p.file.Meshes, mesh)
+	p.faces = nil
+}
+
+// parseFloats parses all arguments, at least min values are required
+func parseFloats(args []string, min int) ([]float32, error) {
+
+	if len(args) < min {
+		return nil, fmt.Errorf("%d values required", min)
+	}
+	v := make([]float32, len(args))
+	for i, s := range args {
+		f, err := strconv.ParseFloat(s, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s", s)
+		}
+		v[i] = float32(f)
+	}
+	return v, nil
+}
@@ -0,0 +1,238 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package obj
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/breiting/g3next/loader"
+	"github.com/breiting/g3next/loader/rex"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/roboticeyes/gorexfile/encoding/rexfile"
+)
+
+// area returns the sum of the triangle areas of the mesh
+func area(mesh rexfile.Mesh) float32 {
+	var a float32
+	for _, t := range mesh.Triangles {
+		v0, v1, v2 := mesh.Coords[t.V0], mesh.Coords[t.V1], mesh.Coords[t.V2]
+		a += v1.Sub(v0).Cross(v2.Sub(v0)).Len() / 2
+	}
+	return a
+}
+
+func TestDecode(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		data      string
+		meshes    []string
+		vertices  int // of the first mesh
+		triangles int
+		area      float32
+		normals   bool
+		texCoords bool
+		colors    bool
+	}{
+		{
+			name:      "triangle",
+			data:      "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\n",
+			meshes:    []string{""},
+			vertices:  3,
+			triangles: 1,
+			area:      0.5,
+		},
+		{
+			name: "concave polygon",
+			// a fan around the first corner covers an area of 4
+			data: `v 2 1 0
+v 1 1 0
+v 1 2 0
+v 0 2 0
+v 0 0 0
+v 2 0 0
+f 1 2 3 4 5 6
+`,
+			meshes:    []string{""},
+			vertices:  6,
+			triangles: 4,
+			area:      3,
+		},
+		{
+			name:      "negative indices",
+			data:      "v 0 0 0\nv 1 0 0\nv 1 1 0\nv 0 1 0\nf -4 -3 -2 -1\n",
+			meshes:    []string{""},
+			vertices:  4,
+			triangles: 2,
+			area:      1,
+		},
+		{
+			name: "texture coordinates and normals",
+			data: `v 0 0 0
+v 1 0 0
+v 0 1 0
+vt 0 0
+vt 1 0
+vt 0 1
+vn 0 0 1
+f 1/1/1 2/2/1 3/3/1
+`,
+			meshes:    []string{""},
+			vertices:  3,
+			triangles: 1,
+			area:      0.5,
+			normals:   true,
+			texCoords: true,
+		},
+		{
+			name: "split normals",
+			data: `v 0 0 0
+v 1 0 0
+v 0 1 0
+v 0 0 1
+vn 0 0 1
+vn 0 1 0
+f 1//1 2//1 3//1
+f 1//2 4//2 2//2
+`,
+			meshes:    []string{""},
+			vertices:  6,
+			triangles: 2,
+			area:      1,
+			normals:   true,
+		},
+		{
+			name:      "vertex colors",
+			data:      "v 0 0 0 1 0 0\nv 1 0 0 0 1 0\nv 0 1 0 0 0 1\nf 1 2 3\n",
+			meshes:    []string{""},
+			vertices:  3,
+			triangles: 1,
+			area:      0.5,
+			colors:    true,
+		},
+		{
+			name: "objects",
+			data: `v 0 0 0
+v 1 0 0
+v 0 1 0
+o first
+f 1 2 3
+o second
+f 3 2 1
+`,
+			meshes:    []string{"first", "second"},
+			vertices:  3,
+			triangles: 1,
+			area:      0.5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			file, err := NewDecoderReader(strings.NewReader(tt.data)).Decode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(file.Meshes) != len(tt.meshes) {
+				t.Fatalf("%d meshes, want %d", len(file.Meshes), len(tt.meshes))
+			}
+			for i, mesh := range file.Meshes {
+				if mesh.Name != tt.meshes[i] {
+					t.Errorf("mesh %d is %q, want %q", i, mesh.Name, tt.meshes[i])
+				}
+			}
+
+			mesh := file.Meshes[0]
+			if len(mesh.Coords) != tt.vertices || len(mesh.Triangles) != tt.triangles {
+				t.Errorf("%d vertices and %d triangles, want %d and %d", len(mesh.Coords), len(mesh.Triangles), tt.vertices, tt.triangles)
+			}
+			if a := area(mesh); math.Abs(float64(a-tt.area)) > 1e-5 {
+				t.Errorf("area is %v, want %v", a, tt.area)
+			}
+			if got := len(mesh.Normals) == len(mesh.Coords); got != tt.normals {
+				t.Errorf("%d normals for %d vertices", len(mesh.Normals), len(mesh.Coords))
+			}
+			if got := len(mesh.TexCoords) == len(mesh.Coords); got != tt.texCoords {
+				t.Errorf("%d texture coordinates for %d vertices", len(mesh.TexCoords), len(mesh.Coords))
+			}
+			if got := len(mesh.Colors) == len(mesh.Coords); got != tt.colors {
+				t.Errorf("%d colors for %d vertices", len(mesh.Colors), len(mesh.Coords))
+			}
+		})
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"short face", "v 0 0 0\nv 1 0 0\nf 1 2\n"},
+		{"index out of range", "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 4\n"},
+		{"invalid index", "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 x\n"},
+		{"invalid number", "v 0 0 x\n"},
+		{"missing vertex index", "v 0 0 0\nvt 0 0\nf /1 /1 /1\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewDecoderReader(strings.NewReader(tt.data)).Decode(); err == nil {
+				t.Errorf("no error")
+			}
+		})
+	}
+}
+
+func TestMaterials(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	mtl := "newmtl red\nKd 1 0 0\nKs 0.5 0.5 0.5\nNs 10\nd 0.5\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "scene.mtl"), []byte(mtl), 0644); err != nil {
+		t.Fatal(err)
+	}
+	data := "mtllib scene.mtl\nv 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\nusemtl red\nf 3 2 1\n"
+
+	dec := NewDecoderReader(strings.NewReader(data))
+	dec.SetDir(dir)
+	file, err := dec.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(file.Materials) != 1 || len(file.Meshes) != 2 {
+		t.Fatalf("%d materials and %d meshes, want 1 and 2", len(file.Materials), len(file.Meshes))
+	}
+	m := file.Materials[0]
+	if m.KdRgb != (mgl32.Vec3{1, 0, 0}) || m.Ns != 10 || m.Alpha != 0.5 {
+		t.Errorf("got Kd %v, Ns %v, alpha %v", m.KdRgb, m.Ns, m.Alpha)
+	}
+	if file.Meshes[0].MaterialID != rexfile.NotSpecified || file.Meshes[1].MaterialID != m.ID {
+		t.Errorf("meshes have materials %d and %d, want none and %d", file.Meshes[0].MaterialID, file.Meshes[1].MaterialID, m.ID)
+	}
+}
+
+func TestLoad(t *testing.T) {
+
+	group, err := loader.Load(strings.NewReader("v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\n"), "triangle.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	children := group.Children()
+	if group.Name() != "triangle" || len(children) != 1 || rex.ToMesh(children[0]) == nil {
+		t.Errorf("got %q with %d nodes, want a single mesh", group.Name(), len(children))
+	}
+}
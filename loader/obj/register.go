@@ -0,0 +1,23 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package obj
+
+import (
+	"io"
+
+	"github.com/breiting/g3next/loader"
+	"github.com/g3n/engine/core"
+)
+
+func init() {
+	// OBJ files have no magic bytes, MTL files cannot be resolved from a reader
+	loader.Register(loader.Format{
+		Name:       "OBJ",
+		Extensions: []string{".obj"},
+		Load: func(r io.Reader, name string) (*core.Node, error) {
+			return NewDecoderReader(r).NewGroup(name)
+		},
+	})
+}
@@ -0,0 +1,374 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package ply reads and writes PLY files in ASCII and binary (little and big
+// endian) format. Vertices with faces are loaded as mesh, vertices without
+// faces as point list. Positions, colors and normals are supported.
+package ply
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/breiting/g3next/geom"
+	"github.com/breiting/g3next/loader/rex"
+	"github.com/g3n/engine/core"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/roboticeyes/gorexfile/encoding/rexfile"
+)
+
+// Format is the encoding of the PLY data
+type Format int
+
+const (
+	// ASCII stores the values as text
+	ASCII Format = iota
+	// BinaryLittleEndian stores the values in little endian byte order
+	BinaryLittleEndian
+	// BinaryBigEndian stores the values in big endian byte order
+	BinaryBigEndian
+)
+
+var formatNames = map[string]Format{
+	"ascii":                ASCII,
+	"binary_little_endian": BinaryLittleEndian,
+	"binary_big_endian":    BinaryBigEndian,
+}
+
+// property of an element, for lists count is the type of the length
+type property struct {
+	name  string
+	typ   string
+	count string // type of the list length, empty if not a list
+}
+
+type element struct {
+	name       string
+	count      int
+	properties []property
+}
+
+type header struct {
+	format   Format
+	elements []element
+}
+
+// Decoder is the PLY file decoder
+type Decoder struct {
+	r    io.Reader
+	opts rex.LoadOptions
+}
+
+// NewDecoder reads the PLY file
+func NewDecoder(plyFile string) (*Decoder, error) {
+
+	data, err := ioutil.ReadFile(plyFile)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot open file %s", plyFile)
+	}
+	return &Decoder{r: bytes.NewReader(data)}, nil
+}
+
+// NewDecoderReader creates a decoder with a reader
+func NewDecoderReader(r io.Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+// SetOptions sets the options used for building the scene graph
+func (dec *Decoder) SetOptions(opts rex.LoadOptions) {
+	dec.opts = opts
+}
+
+// NewGroup decodes the PLY file and returns a group containing either a
+// mesh or a point list
+func (dec *Decoder) NewGroup(name string) (*core.Node, error) {
+
+	file, err := dec.Decode()
+	if err != nil {
+		return nil, err
+	}
+	group, _, err := rex.CreateRexNodeOptions(file, name, dec.opts)
+	return group, err
+}
+
+// Decode reads the PLY file and converts it into a REX mesh or point list
+func (dec *Decoder) Decode() (*rexfile.File, error) {
+
+	br := bufio.NewReader(dec.r)
+	hdr, err := readHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	var next func(typ string) (float64, error)
+	switch hdr.format {
+	case ASCII:
+		scanner := bufio.NewScanner(br)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		scanner.Split(bufio.ScanWords)
+		next = func(typ string) (float64, error) {
+			if !scanner.Scan() {
+				if err := scanner.Err(); err != nil {
+					return 0, err
+				}
+				return 0, io.ErrUnexpectedEOF
+			}
+			return strconv.ParseFloat(scanner.Text(), 64)
+		}
+	case BinaryLittleEndian:
+		next = binaryReader(br, binary.LittleEndian)
+	case BinaryBigEndian:
+		next = binaryReader(br, binary.BigEndian)
+	}
+
+	var positions, colors, normals []mgl32.Vec3
+	var triangles []rexfile.Triangle
+
+	for _, el := range hdr.elements {
+		idx := make(map[string]int)
+		for i, p := range el.properties {
+			idx[p.name] = i
+		}
+
+		values := make([]float64, len(el.properties))
+		var list []float64
+		for n := 0; n < el.count; n++ {
+			for i, p := range el.properties {
+				if p.count == "" {
+					if values[i], err = next(p.typ); err != nil {
+						return nil, fmt.Errorf("Cannot read PLY %s %d: %v", el.name, n, err)
+					}
+					continue
+				}
+				length, err := next(p.count)
+				if err != nil {
+					return nil, fmt.Errorf("Cannot read PLY %s %d: %v", el.name, n, err)
+				}
+				list = list[:0]
+				for k := 0; k < int(length); k++ {
+					v, err := next(p.typ)
+					if err != nil {
+						return nil, fmt.Errorf("Cannot read PLY %s %d: %v", el.name, n, err)
+					}
+					// only the list of faces is kept
+					if el.name == "face" && (p.name == "vertex_indices" || p.name == "vertex_index") {
+						list = append(list, v)
+					}
+				}
+			}
+
+			switch el.name {
+			case "vertex":
+				positions = append(positions, vec3(values, idx, "x", "y", "z"))
+				if c, ok := color(values, el.properties, idx); ok {
+					colors = append(colors, c)
+				}
+				if _, ok := idx["nx"]; ok {
+					normals = append(normals, vec3(values, idx, "nx", "ny", "nz"))
+				}
+			case "face":
+				triangles = append(triangles, triangulate(positions, list)...)
+			}
+		}
+	}
+
+	file := &rexfile.File{}
+	if len(triangles) == 0 {
+		file.PointLists = append(file.PointLists, rexfile.PointList{
+			ID:     1,
+			Points: positions,
+			Colors: colors,
+		})
+		return file, nil
+	}
+	file.Meshes = append(file.Meshes, rexfile.Mesh{
+		ID:         1,
+		Coords:     positions,
+		Colors:     colors,
+		Normals:    normals,
+		Triangles:  triangles,
+		MaterialID: rexfile.NotSpecified,
+	})
+	return file, nil
+}
+
+func readHeader(br *bufio.Reader) (*header, error) {
+
+	hdr := &header{}
+	line, err := br.ReadString('\n')
+	if err != nil || strings.TrimSpace(line) != "ply" {
+		return nil, fmt.Errorf("Cannot read PLY header: not a PLY file")
+	}
+
+	hasFormat := false
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("Cannot read PLY header: %v", err)
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "format":
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("Cannot read PLY header: invalid format")
+			}
+			f, ok := formatNames[fields[1]]
+			if !ok {
+				return nil, fmt.Errorf("Cannot read PLY header: unknown format %s", fields[1])
+			}
+			hdr.format = f
+			hasFormat = true
+		case "element":
+			if len(fields) < 3 {
+				return nil, fmt.Errorf("Cannot read PLY header: invalid element")
+			}
+			count, err := strconv.Atoi(fields[2])
+			if err != nil || count < 0 {
+				return nil, fmt.Errorf("Cannot read PLY header: invalid element count %s", fields[2])
+			}
+			hdr.elements = append(hdr.elements, element{name: fields[1], count: count})
+		case "property":
+			if len(hdr.elements) == 0 {
+				return nil, fmt.Errorf("Cannot read PLY header: property without element")
+			}
+			var p property
+			if len(fields) == 5 && fields[1] == "list" {
+				p = property{name: fields[4], typ: fields[3], count: fields[2]}
+			} else if len(fields) == 3 {
+				p = property{name: fields[2], typ: fields[1]}
+			} else {
+				return nil, fmt.Errorf("Cannot read PLY header: invalid property")
+			}
+			if typeSize(p.typ) == 0 || (p.count != "" && typeSize(p.count) == 0) {
+				return nil, fmt.Errorf("Cannot read PLY header: unknown type in property %s", p.name)
+			}
+			el := &hdr.elements[len(hdr.elements)-1]
+			el.properties = append(el.properties, p)
+		case "end_header":
+			if !hasFormat {
+				return nil, fmt.Errorf("Cannot read PLY header: missing format")
+			}
+			return hdr, nil
+		}
+		// comment and obj_info are ignored
+	}
+}
+
+// typeSize returns the size in bytes of a PLY type, 0 if unknown
+func typeSize(typ string) int {
+	switch typ {
+	case "char", "uchar", "int8", "uint8":
+		return 1
+	case "short", "ushort", "int16", "uint16":
+		return 2
+	case "int", "uint", "int32", "uint32", "float", "float32":
+		return 4
+	case "double", "float64":
+		return 8
+	}
+	return 0
+}
+
+// binaryReader returns a function reading the next value of the given type
+func binaryReader(r io.Reader, order binary.ByteOrder) func(typ string) (float64, error) {
+
+	buf := make([]byte, 8)
+	return func(typ string) (float64, error) {
+		b := buf[:typeSize(typ)]
+		if _, err := io.ReadFull(r, b); err != nil {
+			return 0, err
+		}
+		switch typ {
+		case "char", "int8":
+			return float64(int8(b[0])), nil
+		case "uchar", "uint8":
+			return float64(b[0]), nil
+		case "short", "int16":
+			return float64(int16(order.Uint16(b))), nil
+		case "ushort", "uint16":
+			return float64(order.Uint16(b)), nil
+		case "int", "int32":
+			return float64(int32(order.Uint32(b))), nil
+		case "uint", "uint32":
+			return float64(order.Uint32(b)), nil
+		case "float", "float32":
+			return float64(math.Float32frombits(order.Uint32(b))), nil
+		}
+		return math.Float64frombits(order.Uint64(b)), nil
+	}
+}
+
+// triangulate splits the face into triangles. Polygons may be concave, they
+// are triangulated as fan if they refer to vertices which are not read yet.
+func triangulate(positions []mgl32.Vec3, face []float64) []rexfile.Triangle {
+
+	var corners []mgl32.Vec3
+	for _, idx := range face {
+		if idx < 0 || int(idx) >= len(positions) {
+			corners = nil
+			break
+		}
+		corners = append(corners, positions[int(idx)])
+	}
+
+	var polygon [][3]int
+	if len(face) > 3 && corners != nil {
+		polygon = geom.TriangulatePolygon(corners)
+	} else {
+		for k := 1; k+1 < len(face); k++ {
+			polygon = append(polygon, [3]int{0, k, k + 1})
+		}
+	}
+
+	triangles := make([]rexfile.Triangle, len(polygon))
+	for i, t := range polygon {
+		triangles[i] = rexfile.Triangle{
+			V0: uint32(face[t[0]]),
+			V1: uint32(face[t[1]]),
+			V2: uint32(face[t[2]]),
+		}
+	}
+	return triangles
+}
+
+func vec3(values []float64, idx map[string]int, x, y, z string) mgl32.Vec3 {
+	var v mgl32.Vec3
+	for i, name := range []string{x, y, z} {
+		if k, ok := idx[name]; ok {
+			v[i] = float32(values[k])
+		}
+	}
+	return v
+}
+
+// color returns the vertex color in the range 0..1, integer colors are scaled
+func color(values []float64, properties []property, idx map[string]int) (mgl32.Vec3, bool) {
+
+	for _, prefix := range []string{"", "diffuse_"} {
+		k, ok := idx[prefix+"red"]
+		if !ok {
+			continue
+		}
+		c := vec3(values, idx, prefix+"red", prefix+"green", prefix+"blue")
+		switch properties[k].typ {
+		case "uchar", "uint8":
+			c = c.Mul(1.0 / 255)
+		case "ushort", "uint16":
+			c = c.Mul(1.0 / 65535)
+		}
+		return c, true
+	}
+	return mgl32.Vec3{}, false
+}
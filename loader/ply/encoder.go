@@ -0,0 +1,171 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ply
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/breiting/g3next/loader/internal/writer"
+	"github.com/breiting/g3next/loader/rex"
+	"github.com/g3n/engine/core"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/roboticeyes/gorexfile/encoding/rexfile"
+)
+
+// Encoder writes a node tree as PLY file
+type Encoder struct {
+	w      io.Writer
+	format Format
+}
+
+// NewEncoder creates an encoder writing the PLY data in the given format
+func NewEncoder(w io.Writer, format Format) *Encoder {
+	return &Encoder{w: w, format: format}
+}
+
+// Encode writes the meshes of the node tree, or its point lists if it has no
+// meshes (see WritePLY). The world transforms are baked into the coordinates,
+// the transformation of the root node itself is not exported (see
+// rex.CreateRexFile).
+func (enc *Encoder) Encode(root core.INode) error {
+	return WritePLY(enc.w, rex.CreateRexFile(root), enc.format)
+}
+
+// WritePLY writes the meshes of the REX file as one vertex and face element.
+// Point lists are only written if there are no faces, since readers take all
+// vertices of a file with faces as mesh vertices. Colors and normals are only
+// written if every vertex has one.
+func WritePLY(w io.Writer, file *rexfile.File, format Format) error {
+
+	var positions, colors, normals []mgl32.Vec3
+	var faces []rexfile.Triangle
+
+	for _, mesh := range rex.BakeSceneNodes(file) {
+		offset := uint32(len(positions))
+		positions = append(positions, mesh.Coords...)
+		if len(mesh.Colors) == len(mesh.Coords) {
+			colors = append(colors, mesh.Colors...)
+		}
+		if len(mesh.Normals) == len(mesh.Coords) {
+			normals = append(normals, mesh.Normals...)
+		}
+		for _, t := range mesh.Triangles {
+			faces = append(faces, rexfile.Triangle{
+				V0: t.V0 + offset,
+				V1: t.V1 + offset,
+				V2: t.V2 + offset,
+			})
+		}
+	}
+	if len(faces) == 0 {
+		for _, pl := range file.PointLists {
+			positions = append(positions, pl.Points...)
+			if len(pl.Colors) == len(pl.Points) {
+				colors = append(colors, pl.Colors...)
+			}
+		}
+	}
+
+	hasColors := len(colors) == len(positions)
+	hasNormals := len(normals) == len(positions)
+
+	bw := bufio.NewWriter(w)
+	ew := writer.New(bw, "PLY")
+
+	ew.Printf("ply\n")
+	switch format {
+	case BinaryLittleEndian:
+		ew.Printf("format binary_little_endian 1.0\n")
+	case BinaryBigEndian:
+		ew.Printf("format binary_big_endian 1.0\n")
+	default:
+		ew.Printf("format ascii 1.0\n")
+	}
+	ew.Printf("comment g3next\n")
+	ew.Printf("element vertex %d\n", len(positions))
+	ew.Printf("property float x\nproperty float y\nproperty float z\n")
+	if hasNormals {
+		ew.Printf("property float nx\nproperty float ny\nproperty float nz\n")
+	}
+	if hasColors {
+		ew.Printf("property uchar red\nproperty uchar green\nproperty uchar blue\n")
+	}
+	if len(faces) > 0 {
+		ew.Printf("element face %d\n", len(faces))
+		ew.Printf("property list uchar int vertex_indices\n")
+	}
+	ew.Printf("end_header\n")
+
+	switch format {
+	case BinaryLittleEndian, BinaryBigEndian:
+		var order binary.ByteOrder = binary.LittleEndian
+		if format == BinaryBigEndian {
+			order = binary.BigEndian
+		}
+		buf := make([]byte, 4)
+		float := func(f float32) {
+			order.PutUint32(buf, math.Float32bits(f))
+			ew.Write(buf)
+		}
+		for i, p := range positions {
+			float(p.X())
+			float(p.Y())
+			float(p.Z())
+			if hasNormals {
+				n := normals[i]
+				float(n.X())
+				float(n.Y())
+				float(n.Z())
+			}
+			if hasColors {
+				ew.Write(colorBytes(colors[i]))
+			}
+		}
+		for _, t := range faces {
+			ew.Write([]byte{3})
+			for _, v := range []uint32{t.V0, t.V1, t.V2} {
+				order.PutUint32(buf, v)
+				ew.Write(buf)
+			}
+		}
+	default:
+		for i, p := range positions {
+			ew.Printf("%g %g %g", p.X(), p.Y(), p.Z())
+			if hasNormals {
+				n := normals[i]
+				ew.Printf(" %g %g %g", n.X(), n.Y(), n.Z())
+			}
+			if hasColors {
+				c := colorBytes(colors[i])
+				ew.Printf(" %d %d %d", c[0], c[1], c[2])
+			}
+			ew.Printf("\n")
+		}
+		for _, t := range faces {
+			ew.Printf("3 %d %d %d\n", t.V0, t.V1, t.V2)
+		}
+	}
+
+	if err := ew.Err(); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("Cannot write PLY data: %v", err)
+	}
+	return nil
+}
+
+// colorBytes converts the color from 0..1 into uchar values
+func colorBytes(c mgl32.Vec3) []byte {
+	b := make([]byte, 3)
+	for i := 0; i < 3; i++ {
+		b[i] = uint8(mgl32.Clamp(c[i], 0, 1)*255 + 0.5)
+	}
+	return b
+}
@@ -0,0 +1,287 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ply
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/breiting/g3next/loader"
+	"github.com/breiting/g3next/loader/rex"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/roboticeyes/gorexfile/encoding/rexfile"
+)
+
+// area returns the sum of the triangle areas of the mesh
+func area(mesh rexfile.Mesh) float32 {
+	var a float32
+	for _, t := range mesh.Triangles {
+		v0, v1, v2 := mesh.Coords[t.V0], mesh.Coords[t.V1], mesh.Coords[t.V2]
+		a += v1.Sub(v0).Cross(v2.Sub(v0)).Len() / 2
+	}
+	return a
+}
+
+func TestDecode(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		data      string
+		vertices  int
+		triangles int // 0 for point lists
+		area      float32
+		colors    bool
+		normals   bool
+	}{
+		{
+			name: "triangle",
+			data: `ply
+format ascii 1.0
+element vertex 3
+property float x
+property float y
+property float z
+element face 1
+property list uchar int vertex_indices
+end_header
+0 0 0
+1 0 0
+0 1 0
+3 0 1 2
+`,
+			vertices:  3,
+			triangles: 1,
+			area:      0.5,
+		},
+		{
+			name: "concave polygon",
+			// a fan around the first corner covers an area of 4
+			data: `ply
+format ascii 1.0
+element vertex 6
+property float x
+property float y
+property float z
+element face 1
+property list uchar int vertex_index
+end_header
+2 1 0
+1 1 0
+1 2 0
+0 2 0
+0 0 0
+2 0 0
+6 0 1 2 3 4 5
+`,
+			vertices:  6,
+			triangles: 4,
+			area:      3,
+		},
+		{
+			name: "colors, normals and unknown properties",
+			data: `ply
+format ascii 1.0
+comment written by hand
+element vertex 3
+property double x
+property double y
+property double z
+property float nx
+property float ny
+property float nz
+property uchar red
+property uchar green
+property uchar blue
+property float confidence
+element face 1
+property list uchar int vertex_indices
+property int flags
+end_header
+0 0 0 0 0 1 255 0 0 0.5
+1 0 0 0 0 1 0 255 0 0.5
+0 1 0 0 0 1 0 0 255 0.5
+3 0 1 2 7
+`,
+			vertices:  3,
+			triangles: 1,
+			area:      0.5,
+			colors:    true,
+			normals:   true,
+		},
+		{
+			name: "points",
+			data: `ply
+format ascii 1.0
+element vertex 2
+property float x
+property float y
+property float z
+end_header
+0 0 0
+1 2 3
+`,
+			vertices: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			file, err := NewDecoderReader(strings.NewReader(tt.data)).Decode()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.triangles == 0 {
+				if len(file.PointLists) != 1 || len(file.PointLists[0].Points) != tt.vertices {
+					t.Fatalf("got %v, want a point list with %d points", file.PointLists, tt.vertices)
+				}
+				return
+			}
+			if len(file.Meshes) != 1 {
+				t.Fatalf("%d meshes, want 1", len(file.Meshes))
+			}
+			mesh := file.Meshes[0]
+			if len(mesh.Coords) != tt.vertices || len(mesh.Triangles) != tt.triangles {
+				t.Errorf("%d vertices and %d triangles, want %d and %d", len(mesh.Coords), len(mesh.Triangles), tt.vertices, tt.triangles)
+			}
+			if a := area(mesh); math.Abs(float64(a-tt.area)) > 1e-5 {
+				t.Errorf("area is %v, want %v", a, tt.area)
+			}
+			if got := len(mesh.Colors) == len(mesh.Coords); got != tt.colors {
+				t.Errorf("%d colors for %d vertices", len(mesh.Colors), len(mesh.Coords))
+			}
+			if got := len(mesh.Normals) == len(mesh.Coords); got != tt.normals {
+				t.Errorf("%d normals for %d vertices", len(mesh.Normals), len(mesh.Coords))
+			}
+			if tt.colors && mesh.Colors[1] != (mgl32.Vec3{0, 1, 0}) {
+				t.Errorf("color is %v, want green", mesh.Colors[1])
+			}
+		})
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+
+	const vertex = "element vertex 1\nproperty float x\nproperty float y\nproperty float z\n"
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"not ply", "solid cube\n"},
+		{"unknown format", "ply\nformat xml 1.0\nend_header\n"},
+		{"missing format", "ply\n" + vertex + "end_header\n0 0 0\n"},
+		{"unknown type", "ply\nformat ascii 1.0\nelement vertex 1\nproperty complex x\nend_header\n"},
+		{"property without element", "ply\nformat ascii 1.0\nproperty float x\nend_header\n"},
+		{"truncated ascii", "ply\nformat ascii 1.0\n" + vertex + "end_header\n0 0\n"},
+		{"truncated binary", "ply\nformat binary_little_endian 1.0\n" + vertex + "end_header\n\x00\x00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewDecoderReader(strings.NewReader(tt.data)).Decode(); err == nil {
+				t.Errorf("no error")
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+
+	mesh, _ := rexfile.NewCube(1, rexfile.NotSpecified, 2)
+	mesh.Colors = make([]mgl32.Vec3, len(mesh.Coords))
+	for i := range mesh.Colors {
+		mesh.Colors[i] = mgl32.Vec3{1, 0.5, 0}
+	}
+	file := &rexfile.File{Meshes: []rexfile.Mesh{mesh}}
+
+	for _, format := range []Format{ASCII, BinaryLittleEndian, BinaryBigEndian} {
+		var buf bytes.Buffer
+		if err := WritePLY(&buf, file, format); err != nil {
+			t.Fatal(err)
+		}
+
+		decoded, err := NewDecoderReader(bytes.NewReader(buf.Bytes())).Decode()
+		if err != nil {
+			t.Fatalf("format %d: %v", format, err)
+		}
+		if len(decoded.Meshes) != 1 {
+			t.Fatalf("format %d: %d meshes, want 1", format, len(decoded.Meshes))
+		}
+		got := decoded.Meshes[0]
+		if len(got.Coords) != len(mesh.Coords) || len(got.Triangles) != len(mesh.Triangles) {
+			t.Fatalf("format %d: %d vertices and %d triangles, want %d and %d",
+				format, len(got.Coords), len(got.Triangles), len(mesh.Coords), len(mesh.Triangles))
+		}
+		for i, v := range mesh.Coords {
+			if got.Coords[i] != v {
+				t.Errorf("format %d: vertex %d is %v, want %v", format, i, got.Coords[i], v)
+			}
+		}
+		for i, tri := range mesh.Triangles {
+			if got.Triangles[i] != tri {
+				t.Errorf("format %d: triangle %d is %v, want %v", format, i, got.Triangles[i], tri)
+			}
+		}
+		// colors are stored as uchar
+		if c := got.Colors[0]; !c.ApproxEqualThreshold(mgl32.Vec3{1, 0.5, 0}, 1.0/255) {
+			t.Errorf("format %d: color is %v", format, c)
+		}
+
+		group, err := loader.Load(bytes.NewReader(buf.Bytes()), "")
+		if err != nil {
+			t.Fatalf("format %d: %v", format, err)
+		}
+		if children := group.Children(); len(children) != 1 || rex.ToMesh(children[0]) == nil {
+			t.Errorf("format %d: got %d nodes, want a single mesh", format, len(children))
+		}
+	}
+}
+
+func TestWritePointLists(t *testing.T) {
+
+	mesh, _ := rexfile.NewCube(1, rexfile.NotSpecified, 2)
+	points := rexfile.PointList{ID: 2, Points: []mgl32.Vec3{{5, 5, 5}, {6, 6, 6}}}
+
+	tests := []struct {
+		name       string
+		file       rexfile.File
+		meshes     int
+		vertices   int // of the mesh or point list
+		pointLists int
+	}{
+		{"points only", rexfile.File{PointLists: []rexfile.PointList{points}}, 0, 2, 1},
+		{"points are skipped with faces", rexfile.File{Meshes: []rexfile.Mesh{mesh}, PointLists: []rexfile.PointList{points}}, 1, len(mesh.Coords), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			var buf bytes.Buffer
+			if err := WritePLY(&buf, &tt.file, ASCII); err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := NewDecoderReader(bytes.NewReader(buf.Bytes())).Decode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(decoded.Meshes) != tt.meshes || len(decoded.PointLists) != tt.pointLists {
+				t.Fatalf("%d meshes and %d point lists, want %d and %d",
+					len(decoded.Meshes), len(decoded.PointLists), tt.meshes, tt.pointLists)
+			}
+			var vertices int
+			if tt.meshes > 0 {
+				vertices = len(decoded.Meshes[0].Coords)
+			} else {
+				vertices = len(decoded.PointLists[0].Points)
+			}
+			if vertices != tt.vertices {
+				t.Errorf("%d vertices, want %d", vertices, tt.vertices)
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ply
+
+import (
+	"io"
+
+	"github.com/breiting/g3next/loader"
+	"github.com/g3n/engine/core"
+)
+
+func init() {
+	loader.Register(loader.Format{
+		Name:       "PLY",
+		Extensions: []string{".ply"},
+		Magic:      []string{"ply"},
+		Load: func(r io.Reader, name string) (*core.Node, error) {
+			return NewDecoderReader(r).NewGroup(name)
+		},
+	})
+}
@@ -0,0 +1,123 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rex
+
+import (
+	"context"
+	"sync"
+
+	"github.com/g3n/engine/core"
+)
+
+// Queue collects functions which have to be executed on the render goroutine,
+// such as attaching nodes to the scene graph. The render loop calls Drain once
+// per frame.
+type Queue struct {
+	mu    sync.Mutex
+	funcs []func()
+}
+
+// NewQueue creates an empty queue
+func NewQueue() *Queue {
+	return &Queue{}
+}
+
+// Post adds a function to the queue, it can be called from any goroutine
+func (q *Queue) Post(f func()) {
+	q.mu.Lock()
+	q.funcs = append(q.funcs, f)
+	q.mu.Unlock()
+}
+
+// Drain executes all queued functions. It must only be called from the render goroutine.
+func (q *Queue) Drain() {
+	q.mu.Lock()
+	funcs := q.funcs
+	q.funcs = nil
+	q.mu.Unlock()
+
+	for _, f := range funcs {
+		f()
+	}
+}
+
+// AsyncLoad is a REX file which is decoded in the background
+type AsyncLoad struct {
+	group  *core.Node
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+// NewGroupAsync returns an empty group right away and decodes the REX file on
+// a separate goroutine. The nodes are built off the render goroutine and
+// attached to the group through the queue once the file is decoded, the GL
+// resources are then created by the renderer on the next frame. onProgress is
+// called from the decoding goroutine and may be nil.
+func (dec *Decoder) NewGroupAsync(ctx context.Context, name string, queue *Queue, onProgress ProgressFunc) *AsyncLoad {
+
+	ctx, cancel := context.WithCancel(ctx)
+	l := &AsyncLoad{
+		group:  core.NewNode(),
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	l.group.SetName(name)
+
+	go func() {
+		staging := core.NewNode()
+		err := dec.StreamContext(ctx, staging, nil, onProgress)
+		if err != nil {
+			l.finish(err)
+			return
+		}
+
+		queue.Post(func() {
+			if ctx.Err() != nil {
+				l.finish(ctx.Err())
+				return
+			}
+			l.group.SetUserData(staging.UserData())
+			// adding a child removes it from the staging node
+			children := append([]core.INode(nil), staging.Children()...)
+			for _, child := range children {
+				l.group.Add(child)
+			}
+			l.finish(nil)
+		})
+	}()
+
+	return l
+}
+
+func (l *AsyncLoad) finish(err error) {
+	l.err = err
+	l.cancel()
+	close(l.done)
+}
+
+// Group returns the group which receives the nodes once loading is finished
+func (l *AsyncLoad) Group() *core.Node {
+	return l.group
+}
+
+// Cancel aborts the loading. The group stays empty.
+func (l *AsyncLoad) Cancel() {
+	l.cancel()
+}
+
+// Done returns a channel which is closed when the loading is finished or cancelled
+func (l *AsyncLoad) Done() <-chan struct{} {
+	return l.done
+}
+
+// Err returns the error of the loading after Done is closed. If the loading was
+// cancelled, the context error is returned.
+func (l *AsyncLoad) Err() error {
+	<-l.done
+	return l.err
+}
@@ -0,0 +1,436 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rex
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/breiting/g3next/entity"
+	"github.com/breiting/g3next/geom"
+	"github.com/breiting/g3next/mat"
+	"github.com/g3n/engine/core"
+	"github.com/g3n/engine/geometry"
+	"github.com/g3n/engine/gls"
+	"github.com/g3n/engine/graphic"
+	"github.com/g3n/engine/material"
+	"github.com/g3n/engine/math32"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/roboticeyes/gorexfile/encoding/rexfile"
+)
+
+// NodeFunc is called for every node which is added to the group while building
+type NodeFunc func(node core.INode)
+
+// sceneBuilder creates the nodes for the REX data blocks one by one. The
+// blocks can arrive in any order, references between them (materials, images,
+// scene nodes) are resolved as soon as both sides are known.
+type sceneBuilder struct {
+	ctx    context.Context // nothing is built any more once it is done
+	group  *core.Node
+	onNode NodeFunc
+	opts   LoadOptions
+	source string      // name of the REX file, empty if unknown
+	report *LoadReport // receives the unresolved references
+	conv   *axisMatrix // coordinate conversion, nil if not needed
+	geo    *georeferencer
+
+	cache      *mat.Cache
+	meshByID   map[uint64]*entity.RexMesh
+	byMaterial map[uint64][]*entity.RexMesh // meshes by material ID
+	materials  map[uint64]rexfile.Material
+	images     map[uint64]rexfile.Image
+	byTexture  map[uint64][]uint64 // material IDs by image ID
+
+	batch     []rexfile.Mesh // prepared meshes waiting for their geometry
+	batchSize int            // number of meshes built together
+
+	placed    map[uint64]bool                // mesh is already placed by a scene node
+	instances map[uint64][]*graphic.Mesh     // further placements by mesh ID
+	pending   map[uint64][]rexfile.SceneNode // scene nodes waiting for their mesh
+	filtered  map[uint64]bool                // meshes dropped by the filter
+
+	instanced map[uint64]bool         // meshes referenced by scene nodes, nil if not known in advance
+	unshifted map[uint64][]mgl32.Vec3 // file coordinates of localized meshes, until a scene node needs them
+}
+
+func newSceneBuilder(group *core.Node, onNode NodeFunc, opts LoadOptions, report *LoadReport) *sceneBuilder {
+	return &sceneBuilder{
+		ctx:        context.Background(),
+		batchSize:  batchSize(opts.Concurrency),
+		group:      group,
+		onNode:     onNode,
+		opts:       opts,
+		report:     report,
+		conv:       opts.Coordinates.converter(),
+		geo:        newGeoreferencer(opts),
+		cache:      mat.NewCache(),
+		meshByID:   make(map[uint64]*entity.RexMesh),
+		byMaterial: make(map[uint64][]*entity.RexMesh),
+		materials:  make(map[uint64]rexfile.Material),
+		images:     make(map[uint64]rexfile.Image),
+		byTexture:  make(map[uint64][]uint64),
+		placed:     make(map[uint64]bool),
+		instances:  make(map[uint64][]*graphic.Mesh),
+		pending:    make(map[uint64][]rexfile.SceneNode),
+		filtered:   make(map[uint64]bool),
+		unshifted:  make(map[uint64][]mgl32.Vec3),
+	}
+}
+
+// expectSceneNodes announces all scene nodes before any mesh is added. The
+// meshes referenced by them keep their file coordinates from the start.
+func (b *sceneBuilder) expectSceneNodes(nodes []rexfile.SceneNode) {
+
+	b.instanced = make(map[uint64]bool)
+	if !b.opts.Filter.acceptType(TypeSceneNode) {
+		return
+	}
+	for _, node := range nodes {
+		b.instanced[node.GeometryID] = true
+	}
+}
+
+// setCRS sets the coordinate system of the file and attaches the
+// georeference to the group
+func (b *sceneBuilder) setCRS(crs CRS) {
+	b.geo.setCRS(crs)
+	b.group.SetUserData(b.geo.geo)
+}
+
+func (b *sceneBuilder) add(node core.INode) {
+	b.group.Add(node)
+	if b.onNode != nil {
+		b.onNode(node)
+	}
+}
+
+// skipMesh records a mesh which is not loaded because of the filter
+func (b *sceneBuilder) skipMesh(id uint64) {
+	b.filtered[id] = true
+}
+
+// addMesh prepares the mesh and queues it for the worker pool, the mesh is
+// placed as soon as the batch is full or flushed
+func (b *sceneBuilder) addMesh(data rexfile.Mesh) error {
+
+	data, ok, err := b.prepareMesh(data)
+	if !ok {
+		return err
+	}
+	b.batch = append(b.batch, data)
+	if len(b.batch) >= b.batchSize {
+		b.flush()
+	}
+	return nil
+}
+
+// prepareMesh filters, validates and transforms the mesh datablock. It
+// returns false if the mesh is not loaded.
+func (b *sceneBuilder) prepareMesh(data rexfile.Mesh) (rexfile.Mesh, bool, error) {
+
+	if !b.opts.Filter.acceptMesh(data) {
+		b.skipMesh(data.ID)
+		return data, false, nil
+	}
+	if err := validateMesh(data); err != nil {
+		return data, false, err
+	}
+	// scene nodes place their meshes with a localized translation, the
+	// vertices are kept to preserve the precision of small instanced meshes
+	if !b.instanced[data.ID] {
+		coords := data.Coords
+		data = b.geo.mesh(data)
+		if b.instanced == nil && b.geo.active {
+			b.unshifted[data.ID] = coords
+		}
+	}
+	if b.conv != nil {
+		data = b.conv.mesh(data)
+	}
+	return data, true, nil
+}
+
+// placeMesh creates the mesh node for the prepared datablock and its geometry
+func (b *sceneBuilder) placeMesh(data rexfile.Mesh, g *geometry.Geometry) {
+
+	m := entity.NewRexMeshFromGeometry(data, g)
+	md := b.newMetadata(TypeMesh, m.ID(), len(data.Coords))
+	md.MaterialID = data.MaterialID
+	md.Triangles = len(g.Indices()) / 3
+	m.SetUserData(md)
+	b.meshByID[m.ID()] = m
+	b.byMaterial[m.MaterialID()] = append(b.byMaterial[m.MaterialID()], m)
+	b.applyMaterial(m)
+
+	// IMPORTANT: do not directly add the wrapped object, but only the embedded Mesh,
+	// otherwise the collider is not working!
+	b.add(m.Mesh)
+
+	nodes := b.pending[m.ID()]
+	delete(b.pending, m.ID())
+	for _, node := range nodes {
+		b.addSceneNode(node)
+	}
+}
+
+func (b *sceneBuilder) addMaterial(data rexfile.Material) {
+
+	if !b.opts.Filter.acceptType(TypeMaterial) {
+		return
+	}
+
+	b.materials[data.ID] = data
+	b.byTexture[data.KdTextureID] = append(b.byTexture[data.KdTextureID], data.ID)
+	for _, m := range b.byMaterial[data.ID] {
+		b.applyMaterial(m)
+	}
+}
+
+func (b *sceneBuilder) addImage(img rexfile.Image) error {
+
+	if !b.opts.Filter.acceptType(TypeImage) {
+		return nil
+	}
+
+	if err := validateImage(img); err != nil {
+		return err
+	}
+
+	b.images[img.ID] = img
+	for _, id := range b.byTexture[img.ID] {
+		b.cache.ApplyTexture(id, img)
+	}
+	return nil
+}
+
+// applyMaterial sets the shared material and texture of the mesh and its
+// instances, if they are already known
+func (b *sceneBuilder) applyMaterial(m *entity.RexMesh) {
+
+	data, ok := b.materials[m.MaterialID()]
+	if !ok {
+		return
+	}
+	m.ApplyMaterial(b.cache, data)
+	if md, ok := MetadataOf(m); ok {
+		md.TextureID = data.KdTextureID
+	}
+	if img, ok := b.images[data.KdTextureID]; ok {
+		b.cache.ApplyTexture(data.ID, img)
+	}
+
+	// instances created before the material was known still have the placeholder
+	imat := m.GetMaterial(0)
+	for _, instance := range b.instances[m.ID()] {
+		if instance.GetMaterial(0) != imat {
+			imat.GetMaterial().Incref()
+			instance.ClearMaterials()
+			instance.AddMaterial(imat, 0, 0)
+		}
+		if md, ok := MetadataOf(instance); ok {
+			md.TextureID = data.KdTextureID
+		}
+	}
+}
+
+// addSceneNode places the mesh referenced by the scene node. All scene nodes
+// referencing the same mesh share its geometry and material.
+func (b *sceneBuilder) addSceneNode(node rexfile.SceneNode) {
+
+	if !b.opts.Filter.acceptType(TypeSceneNode) || b.filtered[node.GeometryID] {
+		return
+	}
+
+	template, ok := b.meshByID[node.GeometryID]
+	if !ok {
+		b.pending[node.GeometryID] = append(b.pending[node.GeometryID], node)
+		return
+	}
+	if coords, ok := b.unshifted[node.GeometryID]; ok {
+		b.restore(template, coords)
+		delete(b.unshifted, node.GeometryID)
+	}
+	if node.Scale.X() == 0 && node.Scale.Y() == 0 && node.Scale.Z() == 0 {
+		// older writers leave the scale empty
+		node.Scale = mgl32.Vec3{1, 1, 1}
+	}
+	node = b.geo.sceneNode(node)
+	if b.conv != nil {
+		node = b.conv.sceneNode(node)
+	}
+
+	// the first scene node takes the template itself, all others get an instance
+	var mesh *graphic.Mesh
+	if b.placed[node.GeometryID] {
+		mesh = template.Instance()
+		if md, ok := MetadataOf(template); ok {
+			instance := *md
+			mesh.SetUserData(&instance)
+		}
+		b.instances[node.GeometryID] = append(b.instances[node.GeometryID], mesh)
+	} else {
+		mesh = template.Mesh
+		b.placed[node.GeometryID] = true
+	}
+	if md, ok := MetadataOf(mesh); ok {
+		md.SceneNodeID = node.ID
+	}
+
+	name := strings.TrimRight(node.Name, "\x00")
+	if name == "" {
+		name = fmt.Sprintf("scenenode-%d", node.ID)
+	}
+	mesh.SetName(name)
+
+	mesh.SetPosition(node.Translation.X(), node.Translation.Y(), node.Translation.Z())
+	mesh.SetQuaternion(node.Rotation.X(), node.Rotation.Y(), node.Rotation.Z(), node.Rotation.W())
+	mesh.SetScale(node.Scale.X(), node.Scale.Y(), node.Scale.Z())
+
+	if mesh != template.Mesh {
+		b.add(mesh)
+	}
+}
+
+// restore puts the file coordinates back into the geometry of a mesh which
+// was localized before a scene node referenced it
+func (b *sceneBuilder) restore(m *entity.RexMesh, coords []mgl32.Vec3) {
+
+	if b.conv != nil {
+		coords = b.conv.applyAll(coords)
+	}
+	g := m.GetGeometry()
+	indices := g.Indices()
+	data := rexfile.Mesh{Coords: coords, Triangles: make([]rexfile.Triangle, len(indices)/3)}
+	for i := range data.Triangles {
+		data.Triangles[i] = rexfile.Triangle{V0: indices[3*i], V1: indices[3*i+1], V2: indices[3*i+2]}
+	}
+	rebuilt := geom.NewRexMeshGeometry(data)
+	for _, attrib := range []gls.AttribType{gls.VertexPosition, gls.VertexNormal} {
+		g.VBO(attrib).SetBuffer(*rebuilt.VBO(attrib).Buffer())
+	}
+	// the callback stops at once, only the cached bounds are reset
+	g.OperateOnVertices(func(*math32.Vector3) bool { return true })
+}
+
+func (b *sceneBuilder) addPointList(pointList rexfile.PointList) error {
+
+	if !b.opts.Filter.acceptType(TypePointList) {
+		return nil
+	}
+
+	if err := validatePointList(pointList); err != nil {
+		return err
+	}
+	pointList = b.geo.pointList(pointList)
+	if b.conv != nil {
+		pointList = b.conv.pointList(pointList)
+	}
+
+	var mat material.IMaterial
+	if len(pointList.Colors) > 0 {
+		mat = material.NewBasic()
+	} else {
+		mat = material.NewStandard(&math32.Color{R: 0.42, G: 0.64, B: 0.42})
+	}
+	points := graphic.NewPoints(geom.NewRexPointGeometry(pointList), mat)
+	points.SetUserData(b.newMetadata(TypePointList, pointList.ID, len(pointList.Points)))
+	b.add(points)
+	return nil
+}
+
+func (b *sceneBuilder) addTrack(track rexfile.Track) {
+
+	if !b.opts.Filter.acceptType(TypeTrack) {
+		return
+	}
+	track = b.geo.track(track)
+	if b.conv != nil {
+		track = b.conv.track(track)
+	}
+
+	mat := material.NewStandard(&math32.Color{R: 0, G: 1, B: 0})
+	lines := graphic.NewLineStrip(geom.NewRexTrackGeometry(track), mat)
+	lines.SetUserData(b.newMetadata(TypeTrack, track.ID, len(track.Points)))
+	b.add(lines)
+}
+
+func (b *sceneBuilder) addLineSet(ls rexfile.LineSet) {
+
+	if !b.opts.Filter.acceptType(TypeLineSet) {
+		return
+	}
+	ls = b.geo.lineSet(ls)
+	if b.conv != nil {
+		ls = b.conv.lineSet(ls)
+	}
+
+	// lines are not lit, the color is taken from the vertices
+	var lines core.INode
+	g := geom.NewRexLineSetGeometry(ls)
+	if b.opts.LineMode == LineSegments {
+		lines = graphic.NewLines(g, material.NewBasic())
+	} else {
+		lines = graphic.NewLineStrip(g, material.NewBasic())
+	}
+	lines.GetNode().SetUserData(b.newMetadata(TypeLineSet, ls.ID, len(ls.Points)))
+	b.add(lines)
+}
+
+func (b *sceneBuilder) addText(text rexfile.Text) {
+
+	if !b.opts.Filter.acceptType(TypeText) {
+		return
+	}
+	text = b.geo.text(text)
+	if b.conv != nil {
+		text = b.conv.text(text)
+	}
+
+	label := entity.NewLabel(text, b.opts.LabelMode == LabelBillboard)
+	if b.opts.LabelMode == LabelPlane {
+		switch b.opts.Coordinates.To {
+		case ZUpRightHanded, ZUpLeftHanded:
+			// stand the plane upright
+			label.Graphic().GetNode().SetRotationX(math.Pi / 2)
+		}
+	}
+	md := b.newMetadata(TypeText, text.ID, 0)
+	label.SetUserData(md)
+	label.Graphic().GetNode().SetUserData(md)
+	b.add(label)
+}
+
+// finish places the remaining meshes and adds all scene nodes to the report
+// whose mesh is missing. Nothing is done if the context is cancelled.
+func (b *sceneBuilder) finish() {
+
+	b.unshifted = nil
+	if b.ctx.Err() != nil {
+		return
+	}
+	b.flush()
+
+	var ids []uint64
+	for id := range b.pending {
+		if !b.filtered[id] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		for _, node := range b.pending[id] {
+			b.report.Skipped = append(b.report.Skipped, SkippedBlock{
+				Type: TypeSceneNode,
+				ID:   node.ID,
+				Err:  fmt.Errorf("geometry %d is not a mesh", id),
+			})
+		}
+	}
+}
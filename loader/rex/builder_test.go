@@ -0,0 +1,201 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rex
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/breiting/g3next/mat"
+	"github.com/g3n/engine/core"
+	"github.com/g3n/engine/gls"
+	"github.com/g3n/engine/graphic"
+	"github.com/g3n/engine/material"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/roboticeyes/gorexfile/encoding/rexfile"
+)
+
+type block interface {
+	Write(w io.Writer) error
+}
+
+// encodeBlocks writes the data blocks in the given order
+func encodeBlocks(t testing.TB, blocks ...block) []byte {
+
+	t.Helper()
+	var buf bytes.Buffer
+	if err := writeRexFile(&buf, &rexfile.File{}, DefaultCRS); err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range blocks {
+		if err := b.Write(&buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestBuilderReferences(t *testing.T) {
+
+	mesh := cube(1, 10, "box", 1)
+	material := rexfile.NewMaterial(10)
+	material.KdTextureID = 20
+	img := pngImage(t, 20)
+	first := rexfile.NewSceneNode(30, 1, "first")
+	second := rexfile.NewSceneNode(31, 1, "second")
+	dangling := rexfile.NewSceneNode(32, 99, "dangling")
+
+	tests := []struct {
+		name   string
+		blocks []block
+	}{
+		{"material first", []block{&material, &img, &mesh, &first, &second, &dangling}},
+		{"scene nodes first", []block{&first, &dangling, &second, &mesh, &material, &img}},
+		{"material last", []block{&mesh, &first, &second, &dangling, &img, &material}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			dec := NewDecoderReader(bytes.NewReader(encodeBlocks(t, tt.blocks...)))
+			group, err := dec.NewGroup("references")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			children := group.Children()
+			if len(children) != 2 {
+				t.Fatalf("%d nodes, want 2", len(children))
+			}
+			for _, child := range children {
+				md, ok := MetadataOf(child)
+				if !ok {
+					t.Fatalf("%s has no metadata", child.GetNode().Name())
+				}
+				if md.TextureID != img.ID {
+					t.Errorf("%s has texture %d, want %d", child.GetNode().Name(), md.TextureID, img.ID)
+				}
+				m, ok := ToMesh(child).GetMaterial(0).(*mat.RexStandardMaterial)
+				if !ok {
+					t.Errorf("%s has no REX material", child.GetNode().Name())
+				} else if m.Texture == nil {
+					t.Errorf("%s has no texture", child.GetNode().Name())
+				}
+			}
+			if ToMesh(children[0]).GetMaterial(0) != ToMesh(children[1]).GetMaterial(0) {
+				t.Errorf("instances do not share the material")
+			}
+
+			skipped := dec.Report().Skipped
+			if len(skipped) != 1 || skipped[0].Type != TypeSceneNode || skipped[0].ID != dangling.ID {
+				t.Errorf("skipped %v, want scene node %d", skipped, dangling.ID)
+			}
+		})
+	}
+}
+
+func TestLineSetModes(t *testing.T) {
+
+	ls := rexfile.LineSet{
+		ID:     1,
+		Colors: mgl32.Vec4{0.25, 0.5, 1, 1},
+		Points: []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {0, 1, 0}},
+	}
+	data := encodeBlocks(t, &ls)
+
+	tests := []struct {
+		name     string
+		mode     LineMode
+		segments bool
+	}{
+		{"strip", LineStrip, false},
+		{"segments", LineSegments, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			dec := NewDecoderReader(bytes.NewReader(data))
+			dec.SetOptions(LoadOptions{LineMode: tt.mode})
+			group, err := dec.NewGroup("lines")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var g graphic.IGraphic
+			switch lines := group.Children()[0].(type) {
+			case *graphic.Lines:
+				if !tt.segments {
+					t.Errorf("got segments, want a strip")
+				}
+				g = lines
+			case *graphic.LineStrip:
+				if tt.segments {
+					t.Errorf("got a strip, want segments")
+				}
+				g = lines
+			default:
+				t.Fatalf("got %T, want lines", lines)
+			}
+
+			if _, ok := g.GetGraphic().GetMaterial(0).(*material.Basic); !ok {
+				t.Errorf("got %T, want an unlit material", g.GetGraphic().GetMaterial(0))
+			}
+			colors := readVectors3(g.GetGraphic().GetGeometry(), gls.VertexColor, nil)
+			if len(colors) != len(ls.Points) {
+				t.Fatalf("%d colors, want %d", len(colors), len(ls.Points))
+			}
+			for _, c := range colors {
+				if c != ls.Colors.Vec3() {
+					t.Errorf("color is %v, want %v", c, ls.Colors.Vec3())
+				}
+			}
+		})
+	}
+}
+
+func TestBuilderCancel(t *testing.T) {
+
+	first := cube(1, rexfile.NotSpecified, "first", 1)
+	second := cube(2, rexfile.NotSpecified, "second", 1)
+	dangling := rexfile.NewSceneNode(32, 99, "dangling")
+
+	tests := []struct {
+		name     string
+		blocks   []block
+		cancelAt uint64 // ID of the block after which the context is cancelled
+	}{
+		{"queued meshes", []block{&first, &second}, first.ID},
+		{"pending scene nodes", []block{&dangling, &first}, dangling.ID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			onProgress := func(p Progress) {
+				if p.BlockID == tt.cancelAt {
+					cancel()
+				}
+			}
+
+			dec := NewDecoderReader(bytes.NewReader(encodeBlocks(t, tt.blocks...)))
+			dec.SetOptions(LoadOptions{Concurrency: 4})
+			group := core.NewNode()
+			if err := dec.StreamContext(ctx, group, nil, onProgress); err != context.Canceled {
+				t.Fatalf("got %v, want %v", err, context.Canceled)
+			}
+			if children := group.Children(); len(children) != 0 {
+				t.Errorf("%d nodes added after cancelling", len(children))
+			}
+			if skipped := dec.Report().Skipped; len(skipped) != 0 {
+				t.Errorf("skipped %v after cancelling", skipped)
+			}
+		})
+	}
+}
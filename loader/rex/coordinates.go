@@ -0,0 +1,170 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rex
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/roboticeyes/gorexfile/encoding/rexfile"
+)
+
+// CoordinateSystem describes the axis convention of coordinates
+type CoordinateSystem int
+
+const (
+	// ZUpRightHanded has z pointing upward and y pointing backward (REX default)
+	ZUpRightHanded CoordinateSystem = iota
+	// YUpRightHanded has y pointing upward and z pointing toward the viewer (OpenGL default)
+	YUpRightHanded
+	// ZUpLeftHanded has z pointing upward and y pointing forward
+	ZUpLeftHanded
+	// YUpLeftHanded has y pointing upward and z pointing away from the viewer
+	YUpLeftHanded
+)
+
+// toZUpRightHanded maps coordinates of each system to ZUpRightHanded
+var toZUpRightHanded = map[CoordinateSystem]axisMatrix{
+	ZUpRightHanded: {{1, 0, 0}, {0, 1, 0}, {0, 0, 1}},
+	YUpRightHanded: {{1, 0, 0}, {0, 0, -1}, {0, 1, 0}},
+	ZUpLeftHanded:  {{1, 0, 0}, {0, -1, 0}, {0, 0, 1}},
+	YUpLeftHanded:  {{1, 0, 0}, {0, 0, 1}, {0, 1, 0}},
+}
+
+// CoordinateConversion converts coordinates from one system into another one.
+// The zero value does not change anything.
+type CoordinateConversion struct {
+	From CoordinateSystem // system of the file
+	To   CoordinateSystem // system of the created nodes
+}
+
+// Apply converts a single position or direction
+func (c CoordinateConversion) Apply(v mgl32.Vec3) mgl32.Vec3 {
+	m := c.matrix()
+	return m.apply(v)
+}
+
+// matrix returns the conversion as matrix
+func (c CoordinateConversion) matrix() axisMatrix {
+	return toZUpRightHanded[c.To].transpose().mul(toZUpRightHanded[c.From])
+}
+
+// converter returns nil if the conversion does not change anything
+func (c CoordinateConversion) converter() *axisMatrix {
+	if c.From == c.To {
+		return nil
+	}
+	m := c.matrix()
+	return &m
+}
+
+// axisMatrix is a 3x3 matrix with signed permutations of the axes (row major)
+type axisMatrix [3][3]float32
+
+func (m axisMatrix) apply(v mgl32.Vec3) mgl32.Vec3 {
+	var r mgl32.Vec3
+	for i := 0; i < 3; i++ {
+		r[i] = m[i][0]*v[0] + m[i][1]*v[1] + m[i][2]*v[2]
+	}
+	return r
+}
+
+func (m axisMatrix) mul(o axisMatrix) axisMatrix {
+	var r axisMatrix
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				r[i][j] += m[i][k] * o[k][j]
+			}
+		}
+	}
+	return r
+}
+
+func (m axisMatrix) transpose() axisMatrix {
+	var r axisMatrix
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			r[i][j] = m[j][i]
+		}
+	}
+	return r
+}
+
+func (m axisMatrix) det() float32 {
+	return m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+}
+
+func (m axisMatrix) applyAll(vs []mgl32.Vec3) []mgl32.Vec3 {
+	r := make([]mgl32.Vec3, len(vs))
+	for i, v := range vs {
+		r[i] = m.apply(v)
+	}
+	return r
+}
+
+// The following functions return converted copies, the data of the given
+// blocks is not modified.
+
+func (m axisMatrix) mesh(mesh rexfile.Mesh) rexfile.Mesh {
+
+	mesh.Coords = m.applyAll(mesh.Coords)
+	mesh.Normals = m.applyAll(mesh.Normals)
+
+	// mirroring changes the orientation of the faces
+	if m.det() < 0 {
+		triangles := make([]rexfile.Triangle, len(mesh.Triangles))
+		for i, t := range mesh.Triangles {
+			triangles[i] = rexfile.Triangle{V0: t.V0, V1: t.V2, V2: t.V1}
+		}
+		mesh.Triangles = triangles
+	}
+	return mesh
+}
+
+func (m axisMatrix) pointList(pointList rexfile.PointList) rexfile.PointList {
+	pointList.Points = m.applyAll(pointList.Points)
+	return pointList
+}
+
+func (m axisMatrix) lineSet(ls rexfile.LineSet) rexfile.LineSet {
+	ls.Points = m.applyAll(ls.Points)
+	return ls
+}
+
+func (m axisMatrix) track(track rexfile.Track) rexfile.Track {
+	points := make([]rexfile.TrackElement, len(track.Points))
+	for i, p := range track.Points {
+		p.Point = m.apply(p.Point)
+		p.Orientation = m.apply(p.Orientation)
+		points[i] = p
+	}
+	track.Points = points
+	return track
+}
+
+func (m axisMatrix) text(text rexfile.Text) rexfile.Text {
+	text.Position = m.apply(text.Position)
+	return text
+}
+
+func (m axisMatrix) sceneNode(node rexfile.SceneNode) rexfile.SceneNode {
+
+	node.Translation = m.apply(node.Translation)
+
+	// the rotation axis is a pseudo vector and flips when mirroring
+	axis := m.apply(node.Rotation.Vec3()).Mul(m.det())
+	node.Rotation = mgl32.Vec4{axis.X(), axis.Y(), axis.Z(), node.Rotation.W()}
+
+	// the scale is only permuted
+	scale := m.apply(node.Scale)
+	for i := range scale {
+		if scale[i] < 0 {
+			scale[i] = -scale[i]
+		}
+	}
+	node.Scale = scale
+	return node
+}
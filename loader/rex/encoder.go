@@ -0,0 +1,535 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rex
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/breiting/g3next/entity"
+	"github.com/breiting/g3next/mat"
+	"github.com/g3n/engine/core"
+	"github.com/g3n/engine/geometry"
+	"github.com/g3n/engine/gls"
+	"github.com/g3n/engine/graphic"
+	"github.com/g3n/engine/material"
+	"github.com/g3n/engine/math32"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/roboticeyes/gorexfile/encoding/rexfile"
+)
+
+const (
+	matrixEpsilon = 1e-6
+)
+
+// DefaultCRS is written to the header if the exported nodes have no georeference
+var DefaultCRS = CRS{SRID: 3876, Name: "EPSG"}
+
+// Encoder is the REX file encoder
+type Encoder struct {
+	w   io.Writer
+	crs *CRS
+}
+
+// NewEncoder creates the given file and prepares an encoder writing to it.
+// The returned close function must be called after encoding.
+func NewEncoder(rexFile string) (*Encoder, func() error, error) {
+
+	file, err := os.Create(rexFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Cannot create file %s", rexFile)
+	}
+	return &Encoder{w: file}, file.Close, nil
+}
+
+// NewEncoderWriter creates an encoder with a writer
+func NewEncoderWriter(w io.Writer) *Encoder {
+	return &Encoder{
+		w: w,
+	}
+}
+
+// SetCRS sets the coordinate system written to the header. By default the
+// georeference of the root node is used (see GeoreferenceOf), the local
+// origin becomes the offset of the file.
+func (enc *Encoder) SetCRS(crs CRS) {
+	enc.crs = &crs
+}
+
+// Encode writes the node tree with all its children as REX file. The
+// transformation of the given root node itself is not exported.
+func (enc *Encoder) Encode(root core.INode) error {
+
+	crs := DefaultCRS
+	if enc.crs != nil {
+		crs = *enc.crs
+	} else if geo, ok := GeoreferenceOf(root); ok {
+		crs = geo.CRS
+		crs.Offset = geo.Origin
+	}
+
+	// the offset is stored as float32, the rounding error is moved into the coordinates
+	var stored mgl64.Vec3
+	for i, v := range crs.Offset {
+		stored[i] = float64(float32(v))
+	}
+	rex := createRexFile(root, crs.Offset.Sub(stored))
+
+	if err := writeRexFile(enc.w, rex, crs); err != nil {
+		return fmt.Errorf("Cannot encode REX file: %v", err)
+	}
+	return nil
+}
+
+// writeRexFile writes the header with the coordinate system and all data
+// blocks. rexfile.Encoder always writes a default coordinate system.
+func writeRexFile(w io.Writer, rex *rexfile.File, crs CRS) error {
+
+	header := rex.Header()
+	header.StartAddr = uint16(rexHeaderSize + 4 + 2 + len(crs.Name) + 12)
+	values := []interface{}{
+		header,
+		crs.SRID,
+		uint16(len(crs.Name)),
+		[]byte(crs.Name),
+		[3]float32{float32(crs.Offset[0]), float32(crs.Offset[1]), float32(crs.Offset[2])},
+	}
+	for _, v := range values {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+
+	// skip the header which is written by rexfile.Encoder
+	var blocks bytes.Buffer
+	if err := rexfile.NewEncoder(&blocks).Encode(*rex); err != nil {
+		return err
+	}
+	_, err := w.Write(blocks.Bytes()[int(rexfile.CreateHeader().StartAddr):])
+	return err
+}
+
+// CreateRexFile converts the node tree into REX data blocks. This is the
+// counterpart of CreateRexNode.
+//
+// Meshes which share their geometry with other meshes or which are
+// transformed relative to the root are written once together with a scene
+// node per occurrence. The transformation of point lists and lines is baked
+// into the coordinates.
+func CreateRexFile(root core.INode) *rexfile.File {
+	return createRexFile(root, mgl64.Vec3{})
+}
+
+// createRexFile is like CreateRexFile but moves all coordinates by the offset
+func createRexFile(root core.INode, offset mgl64.Vec3) *rexfile.File {
+
+	b := &fileBuilder{
+		rex:       &rexfile.File{},
+		nextID:    1,
+		geomUsage: make(map[*geometry.Geometry]int),
+		meshIDs:   make(map[*geometry.Geometry]uint64),
+		materials: make(map[material.IMaterial]uint64),
+		images:    make(map[uint64]uint64),
+		offset:    offset,
+	}
+
+	var m math32.Matrix4
+	m.Identity()
+
+	b.countGeometries(root)
+	for _, child := range root.GetNode().Children() {
+		b.add(child, &m)
+	}
+	return b.rex
+}
+
+// fileBuilder keeps the state while walking the node tree
+type fileBuilder struct {
+	rex       *rexfile.File
+	nextID    uint64
+	geomUsage map[*geometry.Geometry]int
+	meshIDs   map[*geometry.Geometry]uint64
+	materials map[material.IMaterial]uint64
+	images    map[uint64]uint64
+	offset    mgl64.Vec3 // added to all coordinates after the transformation
+}
+
+// move adds the offset to the coordinates in double precision
+func (b *fileBuilder) move(vs []mgl32.Vec3) []mgl32.Vec3 {
+
+	if b.offset == (mgl64.Vec3{}) {
+		return vs
+	}
+	for i, v := range vs {
+		vs[i] = mgl32.Vec3{
+			float32(float64(v[0]) + b.offset[0]),
+			float32(float64(v[1]) + b.offset[1]),
+			float32(float64(v[2]) + b.offset[2]),
+		}
+	}
+	return vs
+}
+
+func (b *fileBuilder) newID() uint64 {
+	id := b.nextID
+	b.nextID++
+	return id
+}
+
+// countGeometries counts how many meshes reference each geometry
+func (b *fileBuilder) countGeometries(inode core.INode) {
+
+	if mesh := ToMesh(inode); mesh != nil {
+		b.geomUsage[mesh.GetGeometry()]++
+	}
+	for _, child := range inode.GetNode().Children() {
+		b.countGeometries(child)
+	}
+}
+
+func (b *fileBuilder) add(inode core.INode, parent *math32.Matrix4) {
+
+	node := inode.GetNode()
+	node.UpdateMatrix()
+	local := node.Matrix()
+	var world math32.Matrix4
+	world.MultiplyMatrices(parent, &local)
+
+	if label, ok := inode.(*entity.Label); ok {
+		// the graphic of the label is not exported
+		b.addText(label, &world)
+		return
+	}
+
+	if mesh := ToMesh(inode); mesh != nil {
+		b.addMesh(mesh, &world)
+	} else {
+		switch g := inode.(type) {
+		case *graphic.Points:
+			b.addPointList(g, &world)
+		case *graphic.LineStrip:
+			if md, ok := MetadataOf(g); ok && md.Type == TypeTrack {
+				b.addTrack(g, &world)
+			} else {
+				b.addLineSet(g, &world)
+			}
+		case *graphic.Lines:
+			b.addLineSet(g, &world)
+		}
+	}
+
+	for _, child := range node.Children() {
+		b.add(child, &world)
+	}
+}
+
+func (b *fileBuilder) addMesh(mesh *graphic.Mesh, world *math32.Matrix4) {
+
+	geom := mesh.GetGeometry()
+	identity := isIdentity(world)
+
+	if b.geomUsage[geom] == 1 && identity {
+		block := MeshBlock(geom, b.newID(), mesh.Name())
+		block.Coords = b.move(block.Coords)
+		block.MaterialID = b.materialID(mesh.GetMaterial(0))
+		b.rex.Meshes = append(b.rex.Meshes, block)
+		return
+	}
+
+	meshID, ok := b.meshIDs[geom]
+	if !ok {
+		meshID = b.newID()
+		block := MeshBlock(geom, meshID, mesh.Name())
+		block.MaterialID = b.materialID(mesh.GetMaterial(0))
+		b.rex.Meshes = append(b.rex.Meshes, block)
+		b.meshIDs[geom] = meshID
+	}
+
+	var pos, scale math32.Vector3
+	var quat math32.Quaternion
+	world.Decompose(&pos, &quat, &scale)
+
+	node := rexfile.NewSceneNode(b.newID(), meshID, mesh.Name())
+	node.Translation = b.move([]mgl32.Vec3{{pos.X, pos.Y, pos.Z}})[0]
+	node.Rotation = mgl32.Vec4{quat.X, quat.Y, quat.Z, quat.W}
+	node.Scale = mgl32.Vec3{scale.X, scale.Y, scale.Z}
+	b.rex.SceneNodes = append(b.rex.SceneNodes, node)
+}
+
+func (b *fileBuilder) addPointList(points *graphic.Points, world *math32.Matrix4) {
+
+	geom := points.GetGeometry()
+	block := rexfile.PointList{
+		ID:     b.newID(),
+		Points: b.move(readVectors3(geom, gls.VertexPosition, world)),
+		Colors: readVectors3(geom, gls.VertexColor, nil),
+	}
+	b.rex.PointLists = append(b.rex.PointLists, block)
+}
+
+func (b *fileBuilder) addTrack(lines *graphic.LineStrip, world *math32.Matrix4) {
+
+	points := b.move(readVectors3(lines.GetGeometry(), gls.VertexPosition, world))
+	block := rexfile.Track{
+		ID:         b.newID(),
+		NrOfPoints: uint32(len(points)),
+	}
+	for _, p := range points {
+		block.Points = append(block.Points, rexfile.TrackElement{Point: p})
+	}
+	b.rex.Tracks = append(b.rex.Tracks, block)
+}
+
+// addLineSet writes line strips and line segments. The color is taken from
+// the first vertex or from a standard material.
+func (b *fileBuilder) addLineSet(lines graphic.IGraphic, world *math32.Matrix4) {
+
+	gr := lines.GetGraphic()
+	block := rexfile.LineSet{
+		ID:     b.newID(),
+		Colors: mgl32.Vec4{1, 1, 1, 1},
+		Points: b.move(readVectors3(gr.GetGeometry(), gls.VertexPosition, world)),
+	}
+	if colors := readVectors3(gr.GetGeometry(), gls.VertexColor, nil); len(colors) > 0 {
+		block.Colors = colors[0].Vec4(1)
+	} else if std, ok := gr.GetMaterial(0).(*material.Standard); ok {
+		c := std.AmbientColor()
+		block.Colors = mgl32.Vec4{c.R, c.G, c.B, 1}
+	}
+	b.rex.LineSets = append(b.rex.LineSets, block)
+}
+
+func (b *fileBuilder) addText(label *entity.Label, world *math32.Matrix4) {
+
+	var pos math32.Vector3
+	pos.SetFromMatrixPosition(world)
+
+	block := label.Data
+	block.ID = b.newID()
+	block.Position = b.move([]mgl32.Vec3{{pos.X, pos.Y, pos.Z}})[0]
+	b.rex.Texts = append(b.rex.Texts, block)
+}
+
+// materialID returns the ID of the material block for the given material. The
+// block is created on first use. Materials without a diffuse color (e.g. for
+// vertex colors) are not written.
+func (b *fileBuilder) materialID(imat material.IMaterial) uint64 {
+
+	if id, ok := b.materials[imat]; ok {
+		return id
+	}
+
+	var block rexfile.Material
+	switch m := imat.(type) {
+	case *mat.RexStandardMaterial:
+		block = m.Data
+		block.KaTextureID = rexfile.NotSpecified
+		block.KdTextureID = rexfile.NotSpecified
+		block.KsTextureID = rexfile.NotSpecified
+		if m.Texture != nil {
+			block.KdTextureID = b.imageID(m.Texture)
+		}
+	case *material.Standard:
+		c := m.AmbientColor()
+		block = rexfile.NewMaterial(0)
+		block.KdRgb = mgl32.Vec3{c.R, c.G, c.B}
+	default:
+		return rexfile.NotSpecified
+	}
+
+	block.ID = b.newID()
+	b.rex.Materials = append(b.rex.Materials, block)
+	b.materials[imat] = block.ID
+	return block.ID
+}
+
+// imageID returns the ID of the image block for the given REX image. The
+// block is created on first use.
+func (b *fileBuilder) imageID(img *rexfile.Image) uint64 {
+
+	if id, ok := b.images[img.ID]; ok {
+		return id
+	}
+	block := *img
+	block.ID = b.newID()
+	b.rex.Images = append(b.rex.Images, block)
+	b.images[img.ID] = block.ID
+	return block.ID
+}
+
+// BakeSceneNodes returns all meshes of the file with the scene node
+// transformations applied, e.g. for formats without instancing. Meshes
+// referenced by scene nodes are only returned transformed, once per scene node.
+// Empty scales and rotations are treated like the decoder does.
+func BakeSceneNodes(file *rexfile.File) []rexfile.Mesh {
+
+	meshByID := make(map[uint64]rexfile.Mesh)
+	placed := make(map[uint64]bool)
+	for _, mesh := range file.Meshes {
+		meshByID[mesh.ID] = mesh
+	}
+	for _, node := range file.SceneNodes {
+		placed[node.GeometryID] = true
+	}
+
+	var meshes []rexfile.Mesh
+	for _, mesh := range file.Meshes {
+		if !placed[mesh.ID] {
+			meshes = append(meshes, mesh)
+		}
+	}
+
+	for _, node := range file.SceneNodes {
+		mesh, ok := meshByID[node.GeometryID]
+		if !ok {
+			continue
+		}
+		// a zero quaternion is normalized to the identity
+		q := mgl32.Quat{W: node.Rotation.W(), V: node.Rotation.Vec3()}.Normalize()
+		s := node.Scale
+		if s.X() == 0 && s.Y() == 0 && s.Z() == 0 {
+			// older writers leave the scale empty
+			s = mgl32.Vec3{1, 1, 1}
+		}
+		det := s[0] * s[1] * s[2]
+
+		baked := mesh
+		baked.ID = node.ID
+		baked.Name = strings.TrimRight(node.Name, "\x00")
+		baked.Coords = make([]mgl32.Vec3, len(mesh.Coords))
+		for i, v := range mesh.Coords {
+			baked.Coords[i] = q.Rotate(mgl32.Vec3{v[0] * s[0], v[1] * s[1], v[2] * s[2]}).Add(node.Translation)
+		}
+
+		// normals are transformed by the inverse transpose, the cofactors
+		// have the same direction and stay finite for a zero scale
+		cofactor := mgl32.Vec3{s[1] * s[2], s[0] * s[2], s[0] * s[1]}
+		if det < 0 {
+			cofactor = cofactor.Mul(-1)
+		}
+		baked.Normals = make([]mgl32.Vec3, len(mesh.Normals))
+		for i, n := range mesh.Normals {
+			n = q.Rotate(mgl32.Vec3{n[0] * cofactor[0], n[1] * cofactor[1], n[2] * cofactor[2]})
+			if n.Len() > 0 {
+				n = n.Normalize()
+			}
+			baked.Normals[i] = n
+		}
+
+		// mirroring changes the orientation of the faces
+		if det < 0 {
+			baked.Triangles = make([]rexfile.Triangle, len(mesh.Triangles))
+			for i, t := range mesh.Triangles {
+				baked.Triangles[i] = rexfile.Triangle{V0: t.V0, V1: t.V2, V2: t.V1}
+			}
+		}
+		meshes = append(meshes, baked)
+	}
+	return meshes
+}
+
+// ToMesh returns the mesh of the node or nil if the node is not a mesh
+func ToMesh(inode core.INode) *graphic.Mesh {
+
+	switch m := inode.(type) {
+	case *graphic.Mesh:
+		return m
+	case *entity.RexMesh:
+		return m.Mesh
+	case *entity.TerrainMesh:
+		return m.Mesh
+	}
+	return nil
+}
+
+// MeshBlock creates a REX mesh datablock from the geometry
+func MeshBlock(geom *geometry.Geometry, id uint64, name string) rexfile.Mesh {
+
+	mesh := rexfile.Mesh{
+		ID:         id,
+		Name:       name,
+		Coords:     readVectors3(geom, gls.VertexPosition, nil),
+		Normals:    readVectors3(geom, gls.VertexNormal, nil),
+		TexCoords:  readVectors2(geom, gls.VertexTexcoord),
+		Colors:     readVectors3(geom, gls.VertexColor, nil),
+		MaterialID: rexfile.NotSpecified,
+	}
+
+	if geom.Indexed() {
+		indices := geom.Indices()
+		for i := 0; i+2 < len(indices); i += 3 {
+			mesh.Triangles = append(mesh.Triangles, rexfile.Triangle{
+				V0: indices[i],
+				V1: indices[i+1],
+				V2: indices[i+2],
+			})
+		}
+	} else {
+		for i := 0; i+2 < len(mesh.Coords); i += 3 {
+			mesh.Triangles = append(mesh.Triangles, rexfile.Triangle{
+				V0: uint32(i),
+				V1: uint32(i + 1),
+				V2: uint32(i + 2),
+			})
+		}
+	}
+	return mesh
+}
+
+// readVectors3 returns all vectors of the given attribute. If m is not nil,
+// the vectors are transformed by the matrix.
+func readVectors3(geom *geometry.Geometry, atype gls.AttribType, m *math32.Matrix4) []mgl32.Vec3 {
+
+	vbo := geom.VBO(atype)
+	if vbo == nil {
+		return nil
+	}
+
+	var vectors []mgl32.Vec3
+	vbo.ReadVectors3(atype, func(v math32.Vector3) bool {
+		if m != nil {
+			v.ApplyMatrix4(m)
+		}
+		vectors = append(vectors, mgl32.Vec3{v.X, v.Y, v.Z})
+		return false
+	})
+	return vectors
+}
+
+// readVectors2 returns all two-dimensional vectors of the given attribute
+func readVectors2(geom *geometry.Geometry, atype gls.AttribType) []mgl32.Vec2 {
+
+	vbo := geom.VBO(atype)
+	if vbo == nil {
+		return nil
+	}
+
+	buffer := *vbo.Buffer()
+	stride := vbo.Stride()
+	offset := vbo.AttribOffset(atype)
+
+	var vectors []mgl32.Vec2
+	for i := offset; i+1 < len(buffer); i += stride {
+		vectors = append(vectors, mgl32.Vec2{buffer[i], buffer[i+1]})
+	}
+	return vectors
+}
+
+func isIdentity(m *math32.Matrix4) bool {
+
+	var identity math32.Matrix4
+	identity.Identity()
+	for i := range m {
+		if math32.Abs(m[i]-identity[i]) > matrixEpsilon {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,381 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rex
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"sort"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/roboticeyes/gorexfile/encoding/rexfile"
+)
+
+const testEpsilon = 1e-4
+
+// encodeFile writes the REX file with the given coordinate system
+func encodeFile(t testing.TB, file *rexfile.File, crs CRS) []byte {
+
+	t.Helper()
+	var buf bytes.Buffer
+	if err := writeRexFile(&buf, file, crs); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func pngImage(t testing.TB, id uint64) rexfile.Image {
+
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	return rexfile.Image{ID: id, Compression: rexfile.Png, Data: buf.Bytes()}
+}
+
+func cube(id, materialID uint64, name string, size float32) rexfile.Mesh {
+	mesh, _ := rexfile.NewCube(id, materialID, size)
+	mesh.Name = name
+	return mesh
+}
+
+func TestEncoderRoundTrip(t *testing.T) {
+
+	textured := rexfile.NewMaterial(10)
+	textured.KdRgb = mgl32.Vec3{0.2, 0.4, 0.6}
+	textured.KdTextureID = 20
+	red := rexfile.NewMaterial(11)
+	red.KdRgb = mgl32.Vec3{1, 0, 0}
+	red.Alpha = 0.5
+
+	instanced := rexfile.NewSceneNode(30, 2, "first")
+	instanced.Translation = mgl32.Vec3{10, 0, 0}
+	instanced.Rotation = mgl32.Vec4{0, 0, 0.70710677, 0.70710677}
+	instanced.Scale = mgl32.Vec3{1, 1, 1}
+	second := rexfile.NewSceneNode(31, 2, "second")
+	second.Translation = mgl32.Vec3{0, 20, 5}
+	second.Rotation = mgl32.Vec4{0, 0, 0, 1}
+	second.Scale = mgl32.Vec3{2, 2, 2}
+
+	tests := []struct {
+		name string
+		file rexfile.File
+		crs  CRS
+	}{
+		{
+			name: "meshes and materials",
+			file: rexfile.File{
+				Meshes:    []rexfile.Mesh{cube(1, 10, "textured", 1), cube(2, 11, "red", 2)},
+				Materials: []rexfile.Material{textured, red},
+				Images:    []rexfile.Image{pngImage(t, 20)},
+			},
+			crs: DefaultCRS,
+		},
+		{
+			name: "scene nodes",
+			file: rexfile.File{
+				Meshes:     []rexfile.Mesh{cube(1, 10, "plain", 1), cube(2, 11, "instanced", 1)},
+				Materials:  []rexfile.Material{textured, red},
+				Images:     []rexfile.Image{pngImage(t, 20)},
+				SceneNodes: []rexfile.SceneNode{instanced, second},
+			},
+			crs: DefaultCRS,
+		},
+		{
+			name: "points, lines, tracks and texts",
+			file: rexfile.File{
+				PointLists: []rexfile.PointList{{
+					ID:     1,
+					Points: []mgl32.Vec3{{0, 0, 0}, {1, 2, 3}, {4, 5, 6}},
+					Colors: []mgl32.Vec3{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}},
+				}},
+				LineSets: []rexfile.LineSet{{
+					ID:     2,
+					Colors: mgl32.Vec4{0, 0, 1, 1},
+					Points: []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}},
+				}},
+				Tracks: []rexfile.Track{{
+					ID:         3,
+					NrOfPoints: 3,
+					Points: []rexfile.TrackElement{
+						{Point: mgl32.Vec3{0, 0, 1}},
+						{Point: mgl32.Vec3{5, 0, 1}},
+						{Point: mgl32.Vec3{5, 5, 1}},
+					},
+				}},
+				Texts: []rexfile.Text{{
+					ID:       4,
+					Red:      1,
+					Alpha:    1,
+					Position: mgl32.Vec3{1, 2, 3},
+					FontSize: 12,
+					Text:     "entrance",
+				}},
+			},
+			crs: DefaultCRS,
+		},
+		{
+			name: "georeferenced",
+			file: rexfile.File{
+				Meshes: []rexfile.Mesh{cube(1, rexfile.NotSpecified, "building", 10)},
+				Texts:  []rexfile.Text{{ID: 2, Alpha: 1, Position: mgl32.Vec3{3, 4, 5}, FontSize: 1, Text: "gate"}},
+			},
+			crs: CRS{SRID: 31256, Name: "EPSG", Offset: mgl64.Vec3{-5000, 340000, 200}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			group, err := NewDecoderReader(bytes.NewReader(encodeFile(t, &tt.file, tt.crs))).NewGroup("roundtrip")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			if err := NewEncoderWriter(&buf).Encode(group); err != nil {
+				t.Fatal(err)
+			}
+
+			_, crs, err := ReadHeader(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if crs != tt.crs {
+				t.Errorf("CRS is %+v, want %+v", crs, tt.crs)
+			}
+			_, got, err := rexfile.NewDecoder(bytes.NewReader(buf.Bytes())).Decode()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			compareMeshes(t, BakeSceneNodes(&tt.file), BakeSceneNodes(got))
+			compareMaterials(t, &tt.file, got)
+			if len(got.SceneNodes) != len(tt.file.SceneNodes) {
+				t.Errorf("%d scene nodes, want %d", len(got.SceneNodes), len(tt.file.SceneNodes))
+			}
+			comparePoints(t, tt.file, *got)
+		})
+	}
+}
+
+func TestEncodeFractionalOrigin(t *testing.T) {
+
+	// the origin is not representable as float32 offset of the header
+	mesh := cube(1, rexfile.NotSpecified, "building", 10)
+	origin := mgl64.Vec3{1000.1, 2000.2, 0.3}
+	dec := NewDecoderReader(bytes.NewReader(encodeFile(t, &rexfile.File{Meshes: []rexfile.Mesh{mesh}}, CRS{})))
+	dec.SetOptions(LoadOptions{Origin: &origin})
+	group, err := dec.NewGroup("georeferenced")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoderWriter(&buf).Encode(group); err != nil {
+		t.Fatal(err)
+	}
+	_, crs, err := ReadHeader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, got, err := rexfile.NewDecoder(bytes.NewReader(buf.Bytes())).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Meshes) != 1 || len(got.SceneNodes) != 0 {
+		t.Fatalf("%d meshes and %d scene nodes, want a single mesh", len(got.Meshes), len(got.SceneNodes))
+	}
+
+	coords := make([]mgl32.Vec3, len(got.Meshes[0].Coords))
+	for i, v := range got.Meshes[0].Coords {
+		coords[i] = mgl32.Vec3{
+			float32(float64(v[0]) + crs.Offset[0]),
+			float32(float64(v[1]) + crs.Offset[1]),
+			float32(float64(v[2]) + crs.Offset[2]),
+		}
+	}
+	compareVectors(t, "coords", mesh.Coords, coords)
+}
+
+func TestBakeSceneNodes(t *testing.T) {
+
+	triangle := rexfile.Mesh{
+		ID:        1,
+		Coords:    []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}},
+		Normals:   []mgl32.Vec3{{0, 0, 1}, {1, 0, 0}, {0, 0, 1}},
+		Triangles: []rexfile.Triangle{{V0: 0, V1: 1, V2: 2}},
+	}
+
+	tests := []struct {
+		name      string
+		rotation  mgl32.Vec4
+		scale     mgl32.Vec3
+		coords    []mgl32.Vec3
+		normals   []mgl32.Vec3
+		triangles []rexfile.Triangle
+	}{
+		{"empty rotation and scale", mgl32.Vec4{}, mgl32.Vec3{}, triangle.Coords, triangle.Normals, triangle.Triangles},
+		{"rotated", mgl32.Vec4{0, 0, 1, 0}, mgl32.Vec3{2, 2, 2},
+			[]mgl32.Vec3{{0, 0, 0}, {-2, 0, 0}, {0, -2, 0}},
+			[]mgl32.Vec3{{0, 0, 1}, {-1, 0, 0}, {0, 0, 1}},
+			triangle.Triangles},
+		{"mirrored", mgl32.Vec4{0, 0, 0, 1}, mgl32.Vec3{-1, 1, 1},
+			[]mgl32.Vec3{{0, 0, 0}, {-1, 0, 0}, {0, 1, 0}},
+			[]mgl32.Vec3{{0, 0, 1}, {-1, 0, 0}, {0, 0, 1}},
+			[]rexfile.Triangle{{V0: 0, V1: 2, V2: 1}}},
+		{"flattened", mgl32.Vec4{0, 0, 0, 1}, mgl32.Vec3{0, 1, 1},
+			[]mgl32.Vec3{{0, 0, 0}, {0, 0, 0}, {0, 1, 0}},
+			[]mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {0, 0, 0}},
+			triangle.Triangles},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			node := rexfile.NewSceneNode(2, 1, "placed")
+			node.Rotation = tt.rotation
+			node.Scale = tt.scale
+			file := &rexfile.File{Meshes: []rexfile.Mesh{triangle}, SceneNodes: []rexfile.SceneNode{node}}
+
+			meshes := BakeSceneNodes(file)
+			if len(meshes) != 1 {
+				t.Fatalf("%d meshes, want 1", len(meshes))
+			}
+			compareVectors(t, "coords", tt.coords, meshes[0].Coords)
+			compareVectors(t, "normals", tt.normals, meshes[0].Normals)
+			if len(meshes[0].Triangles) != 1 || meshes[0].Triangles[0] != tt.triangles[0] {
+				t.Errorf("triangles are %v, want %v", meshes[0].Triangles, tt.triangles)
+			}
+		})
+	}
+}
+
+// compareMeshes compares the baked meshes by name, the IDs are not kept
+func compareMeshes(t *testing.T, want, got []rexfile.Mesh) {
+
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%d meshes, want %d", len(got), len(want))
+	}
+	byName := func(meshes []rexfile.Mesh) {
+		sort.Slice(meshes, func(i, j int) bool { return meshes[i].Name < meshes[j].Name })
+	}
+	byName(want)
+	byName(got)
+	for i := range want {
+		if got[i].Name != want[i].Name {
+			t.Errorf("mesh %d is %q, want %q", i, got[i].Name, want[i].Name)
+		}
+		compareVectors(t, want[i].Name, want[i].Coords, got[i].Coords)
+		if len(got[i].Triangles) != len(want[i].Triangles) {
+			t.Errorf("mesh %q has %d triangles, want %d", want[i].Name, len(got[i].Triangles), len(want[i].Triangles))
+		}
+	}
+}
+
+// compareMaterials compares the diffuse color, alpha and texture of the
+// materials by the name of the baked meshes
+func compareMaterials(t *testing.T, want, got *rexfile.File) {
+
+	t.Helper()
+	materials := func(f *rexfile.File) map[string]rexfile.Material {
+		byID := make(map[uint64]rexfile.Material)
+		for _, m := range f.Materials {
+			byID[m.ID] = m
+		}
+		r := make(map[string]rexfile.Material)
+		for _, mesh := range BakeSceneNodes(f) {
+			if m, ok := byID[mesh.MaterialID]; ok {
+				r[mesh.Name] = m
+			}
+		}
+		return r
+	}
+
+	wantMaterials, gotMaterials := materials(want), materials(got)
+	for name, w := range wantMaterials {
+		g, ok := gotMaterials[name]
+		if !ok {
+			t.Errorf("mesh %q has no material", name)
+			continue
+		}
+		if g.KdRgb != w.KdRgb || g.Alpha != w.Alpha {
+			t.Errorf("mesh %q has Kd %v alpha %v, want %v %v", name, g.KdRgb, g.Alpha, w.KdRgb, w.Alpha)
+		}
+		if (g.KdTextureID != rexfile.NotSpecified) != (w.KdTextureID != rexfile.NotSpecified) {
+			t.Errorf("mesh %q texture is %d, want %d", name, g.KdTextureID, w.KdTextureID)
+		}
+	}
+	if len(got.Images) != len(want.Images) {
+		t.Errorf("%d images, want %d", len(got.Images), len(want.Images))
+	}
+}
+
+// comparePoints compares point lists, line sets, tracks and texts
+func comparePoints(t *testing.T, want, got rexfile.File) {
+
+	t.Helper()
+	if len(got.PointLists) != len(want.PointLists) {
+		t.Fatalf("%d point lists, want %d", len(got.PointLists), len(want.PointLists))
+	}
+	for i := range want.PointLists {
+		compareVectors(t, "point list", want.PointLists[i].Points, got.PointLists[i].Points)
+		compareVectors(t, "point colors", want.PointLists[i].Colors, got.PointLists[i].Colors)
+	}
+
+	if len(got.LineSets) != len(want.LineSets) {
+		t.Fatalf("%d line sets, want %d", len(got.LineSets), len(want.LineSets))
+	}
+	for i := range want.LineSets {
+		compareVectors(t, "line set", want.LineSets[i].Points, got.LineSets[i].Points)
+		if got.LineSets[i].Colors != want.LineSets[i].Colors {
+			t.Errorf("line set color is %v, want %v", got.LineSets[i].Colors, want.LineSets[i].Colors)
+		}
+	}
+
+	if len(got.Tracks) != len(want.Tracks) {
+		t.Fatalf("%d tracks, want %d", len(got.Tracks), len(want.Tracks))
+	}
+	for i := range want.Tracks {
+		var w, g []mgl32.Vec3
+		for _, p := range want.Tracks[i].Points {
+			w = append(w, p.Point)
+		}
+		for _, p := range got.Tracks[i].Points {
+			g = append(g, p.Point)
+		}
+		compareVectors(t, "track", w, g)
+	}
+
+	if len(got.Texts) != len(want.Texts) {
+		t.Fatalf("%d texts, want %d", len(got.Texts), len(want.Texts))
+	}
+	for i := range want.Texts {
+		w, g := want.Texts[i], got.Texts[i]
+		if g.Text != w.Text || g.FontSize != w.FontSize || g.Red != w.Red || !g.Position.ApproxEqualThreshold(w.Position, testEpsilon) {
+			t.Errorf("text is %+v, want %+v", g, w)
+		}
+	}
+}
+
+func compareVectors(t *testing.T, name string, want, got []mgl32.Vec3) {
+
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("%s has %d vectors, want %d", name, len(got), len(want))
+		return
+	}
+	for i := range want {
+		if !got[i].ApproxEqualThreshold(want[i], testEpsilon) {
+			t.Errorf("%s vector %d is %v, want %v", name, i, got[i], want[i])
+			return
+		}
+	}
+}
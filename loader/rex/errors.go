@@ -0,0 +1,76 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rex
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrTruncated is matched by errors.Is if the REX file ends in the middle of
+// the header or a data block
+var ErrTruncated = errors.New("truncated REX file")
+
+// headerBlock is the block index used for errors in the file header
+const headerBlock = -1
+
+// DecodeError is returned if a part of the REX file cannot be decoded
+type DecodeError struct {
+	Block     int    // index of the data block in the file, -1 for the file header
+	Type      uint16 // type of the data block
+	ID        uint64 // ID of the data block
+	Offset    int64  // byte offset in the file where decoding stopped
+	Truncated bool   // the file ended before the block was complete
+	Err       error  // the underlying error
+}
+
+func (e *DecodeError) Error() string {
+
+	if e.Block == headerBlock {
+		if e.Truncated {
+			return fmt.Sprintf("REX header truncated at offset %d", e.Offset)
+		}
+		return fmt.Sprintf("REX header at offset %d: %v", e.Offset, e.Err)
+	}
+
+	if e.Truncated {
+		return fmt.Sprintf("block %d (%s) truncated at offset %d", e.Block, blockTypeName(e.Type), e.Offset)
+	}
+	return fmt.Sprintf("block %d (%s) at offset %d: %v", e.Block, blockTypeName(e.Type), e.Offset, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the error matches ErrTruncated
+func (e *DecodeError) Is(target error) bool {
+	return target == ErrTruncated && e.Truncated
+}
+
+// blockTypeName returns a readable name for the REX data block type
+func blockTypeName(t uint16) string {
+
+	switch t {
+	case TypeLineSet:
+		return "lineset"
+	case TypeText:
+		return "text"
+	case TypePointList:
+		return "pointlist"
+	case TypeMesh:
+		return "mesh"
+	case TypeImage:
+		return "image"
+	case TypeMaterial:
+		return "material"
+	case TypeSceneNode:
+		return "scenenode"
+	case TypeTrack:
+		return "track"
+	}
+	return fmt.Sprintf("type %d", t)
+}
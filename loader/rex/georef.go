@@ -0,0 +1,209 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rex
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math"
+
+	"github.com/g3n/engine/core"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/roboticeyes/gorexfile/encoding/rexfile"
+)
+
+const (
+	rexHeaderSize = 64
+)
+
+// CRS is the coordinate reference system stored in the REX header
+type CRS struct {
+	SRID   uint32     // spatial reference ID, e.g. the EPSG code
+	Name   string     // authority of the SRID, e.g. "EPSG"
+	Offset mgl64.Vec3 // global offset which is added to all coordinates of the file
+}
+
+// Georeference is attached as user data to the group created by the decoder.
+// The absolute CRS position of a point is Origin plus its local coordinates
+// in the group (before any coordinate conversion).
+type Georeference struct {
+	CRS    CRS
+	Origin mgl64.Vec3
+}
+
+// GeoreferenceOf returns the georeference of a group created by the decoder
+func GeoreferenceOf(inode core.INode) (*Georeference, bool) {
+	geo, ok := inode.GetNode().UserData().(*Georeference)
+	return geo, ok
+}
+
+// ReadHeader reads the REX header including the coordinate system block,
+// which is not provided by rexfile.ReadHeader. Use it to get the CRS of a
+// file which is decoded with rexfile.Decoder (see LoadOptions.CRS).
+func ReadHeader(r io.Reader) (*rexfile.Header, CRS, error) {
+
+	var header rexfile.Header
+	var crs CRS
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return &header, crs, err
+	}
+
+	var sz uint16
+	if err := binary.Read(r, binary.LittleEndian, &crs.SRID); err != nil {
+		return &header, crs, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &sz); err != nil {
+		return &header, crs, err
+	}
+	name := make([]byte, sz)
+	if _, err := io.ReadFull(r, name); err != nil {
+		return &header, crs, err
+	}
+	crs.Name = string(name)
+
+	var offset [3]float32
+	if err := binary.Read(r, binary.LittleEndian, &offset); err != nil {
+		return &header, crs, err
+	}
+	crs.Offset = mgl64.Vec3{float64(offset[0]), float64(offset[1]), float64(offset[2])}
+
+	// skip any padding until the first data block
+	csbSize := 4 + 2 + int64(sz) + 12
+	if rest := int64(header.StartAddr) - rexHeaderSize - csbSize; rest > 0 {
+		if _, err := io.CopyN(ioutil.Discard, r, rest); err != nil {
+			return &header, crs, err
+		}
+	}
+	return &header, crs, nil
+}
+
+// georeferencer moves the file coordinates to the local origin. The
+// subtraction is done in double precision before converting back to float32.
+type georeferencer struct {
+	geo    *Georeference
+	auto   bool       // the origin is taken from the first coordinate
+	shift  mgl64.Vec3 // origin relative to the file coordinates
+	active bool       // coordinates are shifted
+}
+
+func newGeoreferencer(opts LoadOptions) *georeferencer {
+
+	g := &georeferencer{geo: &Georeference{}}
+	if opts.Origin != nil {
+		g.geo.Origin = *opts.Origin
+		g.active = true
+	} else {
+		g.auto = opts.LocalOrigin
+	}
+	return g
+}
+
+// setCRS sets the coordinate system of the file, it must be called before
+// any coordinate is localized
+func (g *georeferencer) setCRS(crs CRS) {
+
+	g.geo.CRS = crs
+	if !g.active && !g.auto {
+		// coordinates are kept as they are in the file
+		g.geo.Origin = crs.Offset
+	}
+	g.shift = g.geo.Origin.Sub(crs.Offset)
+}
+
+// start determines the origin from the first coordinate if necessary
+func (g *georeferencer) start(first mgl32.Vec3) {
+
+	if !g.auto {
+		return
+	}
+	g.auto = false
+	g.active = true
+	for i := range g.geo.Origin {
+		// full meters keep the origin readable
+		g.geo.Origin[i] = math.Floor(g.geo.CRS.Offset[i] + float64(first[i]))
+	}
+	g.shift = g.geo.Origin.Sub(g.geo.CRS.Offset)
+}
+
+func (g *georeferencer) localize(v mgl32.Vec3) mgl32.Vec3 {
+	return mgl32.Vec3{
+		float32(float64(v[0]) - g.shift[0]),
+		float32(float64(v[1]) - g.shift[1]),
+		float32(float64(v[2]) - g.shift[2]),
+	}
+}
+
+func (g *georeferencer) localizeAll(vs []mgl32.Vec3) []mgl32.Vec3 {
+
+	if len(vs) > 0 {
+		g.start(vs[0])
+	}
+	if !g.active {
+		return vs
+	}
+	r := make([]mgl32.Vec3, len(vs))
+	for i, v := range vs {
+		r[i] = g.localize(v)
+	}
+	return r
+}
+
+// The following functions return localized copies, the data of the given
+// blocks is not modified.
+
+func (g *georeferencer) mesh(mesh rexfile.Mesh) rexfile.Mesh {
+	mesh.Coords = g.localizeAll(mesh.Coords)
+	return mesh
+}
+
+func (g *georeferencer) pointList(pointList rexfile.PointList) rexfile.PointList {
+	pointList.Points = g.localizeAll(pointList.Points)
+	return pointList
+}
+
+func (g *georeferencer) lineSet(ls rexfile.LineSet) rexfile.LineSet {
+	ls.Points = g.localizeAll(ls.Points)
+	return ls
+}
+
+func (g *georeferencer) track(track rexfile.Track) rexfile.Track {
+
+	if len(track.Points) > 0 {
+		g.start(track.Points[0].Point)
+	}
+	if !g.active {
+		return track
+	}
+	points := make([]rexfile.TrackElement, len(track.Points))
+	for i, p := range track.Points {
+		p.Point = g.localize(p.Point)
+		points[i] = p
+	}
+	track.Points = points
+	return track
+}
+
+func (g *georeferencer) text(text rexfile.Text) rexfile.Text {
+
+	g.start(text.Position)
+	if g.active {
+		text.Position = g.localize(text.Position)
+	}
+	return text
+}
+
+// sceneNode moves the placement of a mesh. The vertices of meshes placed by
+// scene nodes keep their file coordinates, therefore only the translation is
+// shifted.
+func (g *georeferencer) sceneNode(node rexfile.SceneNode) rexfile.SceneNode {
+
+	g.start(node.Translation)
+	if g.active {
+		node.Translation = g.localize(node.Translation)
+	}
+	return node
+}
@@ -0,0 +1,133 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rex
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/g3n/engine/core"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/roboticeyes/gorexfile/encoding/rexfile"
+)
+
+func TestGeoreference(t *testing.T) {
+
+	crs := CRS{SRID: 31256, Name: "EPSG", Offset: mgl64.Vec3{-5000, 340000, 200}}
+	mesh := cube(1, rexfile.NotSpecified, "building", 10)
+	for i := range mesh.Coords {
+		mesh.Coords[i] = mesh.Coords[i].Add(mgl32.Vec3{120.5, 30.25, 4})
+	}
+	data := encodeFile(t, &rexfile.File{Meshes: []rexfile.Mesh{mesh}}, crs)
+	origin := mgl64.Vec3{-4900, 340000, 200}
+
+	// the local origin is the first coordinate rounded down to full meters
+	first := mesh.Coords[0]
+	floor := mgl32.Vec3{float32(math.Floor(float64(first[0]))), float32(math.Floor(float64(first[1]))), float32(math.Floor(float64(first[2])))}
+	local := crs.Offset.Add(mgl64.Vec3{float64(floor[0]), float64(floor[1]), float64(floor[2])})
+
+	tests := []struct {
+		name   string
+		opts   LoadOptions
+		origin mgl64.Vec3
+		first  mgl32.Vec3 // first coordinate in the group
+	}{
+		{"file coordinates", LoadOptions{}, crs.Offset, first},
+		{"local origin", LoadOptions{LocalOrigin: true}, local, first.Sub(floor)},
+		{"given origin", LoadOptions{Origin: &origin}, origin, first.Sub(mgl32.Vec3{100, 0, 0})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			dec := NewDecoderReader(bytes.NewReader(data))
+			dec.SetOptions(tt.opts)
+			streamed, err := dec.NewGroup("streamed")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, header, err := ReadHeader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, file, err := rexfile.NewDecoder(bytes.NewReader(data)).Decode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := tt.opts
+			opts.CRS = &header
+			decoded, _, err := CreateRexNodeOptions(file, "decoded", opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, group := range []*core.Node{streamed, decoded} {
+				geo, ok := GeoreferenceOf(group)
+				if !ok {
+					t.Fatalf("%s has no georeference", group.Name())
+				}
+				if geo.CRS != crs || geo.Origin != tt.origin {
+					t.Errorf("%s has %+v, want CRS %+v origin %v", group.Name(), geo, crs, tt.origin)
+				}
+				coords := MeshBlock(ToMesh(group.Children()[0]).GetGeometry(), 1, "").Coords
+				if !coords[0].ApproxEqualThreshold(tt.first, testEpsilon) {
+					t.Errorf("%s starts at %v, want %v", group.Name(), coords[0], tt.first)
+				}
+			}
+		})
+	}
+}
+
+func TestGeoreferenceSceneNodes(t *testing.T) {
+
+	// a 1 cm bolt placed twice at UTM coordinates, the streaming decoder
+	// reads the mesh before the scene nodes
+	size := float32(0.01)
+	bolt := cube(1, rexfile.NotSpecified, "bolt", size)
+	nodes := []rexfile.SceneNode{
+		{ID: 2, GeometryID: 1, Translation: mgl32.Vec3{456789, 5400000, 200}, Rotation: mgl32.Vec4{0, 0, 0, 1}},
+		{ID: 3, GeometryID: 1, Translation: mgl32.Vec3{456790, 5400001, 200}, Rotation: mgl32.Vec4{0, 0, 0.7071068, 0.7071068}, Scale: mgl32.Vec3{1, 1, 1}},
+	}
+	data := encodeFile(t, &rexfile.File{Meshes: []rexfile.Mesh{bolt}, SceneNodes: nodes}, CRS{})
+	origin := mgl64.Vec3{456000, 5400000, 0}
+	opts := LoadOptions{Origin: &origin}
+	positions := []mgl32.Vec3{{789, 0, 200}, {790, 1, 200}}
+
+	dec := NewDecoderReader(bytes.NewReader(data))
+	dec.SetOptions(opts)
+	streamed, err := dec.NewGroup("streamed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, file, err := rexfile.NewDecoder(bytes.NewReader(data)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, _, err := CreateRexNodeOptions(file, "decoded", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, group := range []*core.Node{streamed, decoded} {
+		children := group.Children()
+		if len(children) != len(positions) {
+			t.Fatalf("%s has %d children, want %d", group.Name(), len(children), len(positions))
+		}
+		for i, child := range children {
+			p := child.GetNode().Position()
+			if !(mgl32.Vec3{p.X, p.Y, p.Z}).ApproxEqualThreshold(positions[i], testEpsilon) {
+				t.Errorf("%s node %d is at %v, want %v", group.Name(), i, p, positions[i])
+			}
+			box := ToMesh(child).GetGeometry().BoundingBox()
+			extent := box.Max.Clone().Sub(&box.Min)
+			if !(mgl32.Vec3{extent.X, extent.Y, extent.Z}).ApproxEqualThreshold(mgl32.Vec3{size, size, size}, 1e-6) {
+				t.Errorf("%s node %d has the extent %v, want %v", group.Name(), i, extent, size)
+			}
+		}
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rex
+
+import (
+	"fmt"
+
+	"github.com/g3n/engine/core"
+	"github.com/roboticeyes/gorexfile/encoding/rexfile"
+)
+
+// Metadata is attached as user data to every node created from a REX data
+// block and refers back to the block, e.g. for picking
+type Metadata struct {
+	Type        uint16 // type of the data block (TypeMesh, ...)
+	ID          uint64 // ID of the data block
+	SceneNodeID uint64 // ID of the scene node placing the mesh, rexfile.NotSpecified if none
+	MaterialID  uint64 // ID of the material block, rexfile.NotSpecified if none
+	TextureID   uint64 // ID of the diffuse texture image block, rexfile.NotSpecified if none
+	Vertices    int    // number of vertices or points
+	Triangles   int    // number of triangles, 0 if not a mesh
+	Source      string // name of the REX file, empty if read from a reader
+}
+
+// MetadataOf returns the metadata of a node created by the decoder
+func MetadataOf(inode core.INode) (*Metadata, bool) {
+	md, ok := inode.GetNode().UserData().(*Metadata)
+	return md, ok
+}
+
+// String prints the metadata in a single line
+func (md *Metadata) String() string {
+
+	s := fmt.Sprintf("%s %d (%d vertices, %d triangles)", blockTypeName(md.Type), md.ID, md.Vertices, md.Triangles)
+	if md.SceneNodeID != rexfile.NotSpecified {
+		s += fmt.Sprintf(" scenenode %d", md.SceneNodeID)
+	}
+	if md.MaterialID != rexfile.NotSpecified {
+		s += fmt.Sprintf(" material %d", md.MaterialID)
+	}
+	if md.TextureID != rexfile.NotSpecified {
+		s += fmt.Sprintf(" texture %d", md.TextureID)
+	}
+	if md.Source != "" {
+		s += " from " + md.Source
+	}
+	return s
+}
+
+// newMetadata returns the metadata for a data block without references
+func (b *sceneBuilder) newMetadata(typ uint16, id uint64, vertices int) *Metadata {
+	return &Metadata{
+		Type:        typ,
+		ID:          id,
+		SceneNodeID: rexfile.NotSpecified,
+		MaterialID:  rexfile.NotSpecified,
+		TextureID:   rexfile.NotSpecified,
+		Vertices:    vertices,
+		Source:      b.source,
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rex
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"path"
+	"regexp"
+
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/roboticeyes/gorexfile/encoding/rexfile"
+)
+
+// LoadOptions control how the scene graph is built from a REX file
+type LoadOptions struct {
+	// Lenient skips data blocks which cannot be decoded or contain invalid
+	// data and records them in the LoadReport instead of failing.
+	Lenient bool
+
+	// Filter selects the content which is loaded
+	Filter Filter
+
+	// Coordinates converts all coordinates into another axis convention. The
+	// conversion is baked into the vertex data, normals and track
+	// orientations, no extra transformation is added to the nodes.
+	Coordinates CoordinateConversion
+
+	// Origin is subtracted in double precision from all coordinates before
+	// they are stored as float32. It is given in absolute CRS coordinates
+	// (including the offset of the file header). Use the origin of a
+	// previously loaded file to line up several files of the same CRS.
+	Origin *mgl64.Vec3
+
+	// LocalOrigin takes the origin from the first coordinate of the file if
+	// no Origin is given
+	LocalOrigin bool
+
+	// CRS is the coordinate system of an already decoded file passed to
+	// CreateRexNodeOptions, whose header is not available anymore (see
+	// ReadHeader). The streaming decoder reads it from the file header.
+	CRS *CRS
+
+	// LineMode defines how the points of linesets are connected
+	LineMode LineMode
+
+	// LabelMode defines how text blocks are shown
+	LabelMode LabelMode
+
+	// Concurrency is the number of goroutines building the mesh geometries,
+	// GOMAXPROCS if 0. Use 1 to build them on the calling goroutine, streamed
+	// meshes are then added right after their block has been read.
+	Concurrency int
+}
+
+// LineMode defines how the points of a lineset are connected
+type LineMode int
+
+const (
+	// LineStrip connects all points of a lineset with each other (default)
+	LineStrip LineMode = iota
+	// LineSegments connects each pair of points, lines are not connected across the pairs
+	LineSegments
+)
+
+// LabelMode defines how text blocks are shown
+type LabelMode int
+
+const (
+	// LabelBillboard always faces the camera (default)
+	LabelBillboard LabelMode = iota
+	// LabelPlane is an upright plane in world space
+	LabelPlane
+)
+
+// IDRange is an inclusive range of block IDs
+type IDRange struct {
+	First, Last uint64
+}
+
+// Filter selects the data blocks which are loaded. The zero value loads everything.
+type Filter struct {
+	IncludeTypes []uint16 // block types to load, all types if empty
+	ExcludeTypes []uint16 // block types which are never loaded
+
+	MeshIDs        []IDRange      // meshes with an ID in one of the ranges, all if empty
+	MeshName       string         // glob pattern (see path.Match) for mesh names, all if empty
+	MeshNameRegexp *regexp.Regexp // regular expression for mesh names, all if nil
+
+	SkipTextures bool // do not load any images, meshes keep their material color
+}
+
+// acceptType reports whether blocks of the given type are loaded
+func (f *Filter) acceptType(typ uint16) bool {
+
+	if typ == TypeImage && f.SkipTextures {
+		return false
+	}
+	for _, t := range f.ExcludeTypes {
+		if t == typ {
+			return false
+		}
+	}
+	if len(f.IncludeTypes) == 0 {
+		return true
+	}
+	for _, t := range f.IncludeTypes {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptMeshID reports whether the mesh with the given ID is loaded, not considering its name
+func (f *Filter) acceptMeshID(id uint64) bool {
+
+	if !f.acceptType(TypeMesh) {
+		return false
+	}
+	if len(f.MeshIDs) == 0 {
+		return true
+	}
+	for _, r := range f.MeshIDs {
+		if id >= r.First && id <= r.Last {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptMesh reports whether the mesh is loaded
+func (f *Filter) acceptMesh(mesh rexfile.Mesh) bool {
+
+	if !f.acceptMeshID(mesh.ID) {
+		return false
+	}
+	if f.MeshName != "" {
+		if ok, _ := path.Match(f.MeshName, mesh.Name); !ok {
+			return false
+		}
+	}
+	if f.MeshNameRegexp != nil && !f.MeshNameRegexp.MatchString(mesh.Name) {
+		return false
+	}
+	return true
+}
+
+// LoadReport summarizes a finished load
+type LoadReport struct {
+	Skipped []SkippedBlock // data blocks skipped in lenient mode and scene nodes without mesh
+}
+
+// SkippedBlock is a data block which was skipped in lenient mode or whose
+// references could not be resolved
+type SkippedBlock struct {
+	Type uint16 // type of the data block
+	ID   uint64 // ID of the data block
+	Err  error  // reason, a *DecodeError if the block comes from a stream
+}
+
+func (s SkippedBlock) String() string {
+	return fmt.Sprintf("skipped %s %d: %v", blockTypeName(s.Type), s.ID, s.Err)
+}
+
+// validateMesh returns the first problem which would break the geometry of the mesh
+func validateMesh(mesh rexfile.Mesh) error {
+	return firstError(meshDiagnostics(mesh))
+}
+
+// validatePointList returns the first problem which would break the geometry of the point list
+func validatePointList(pointList rexfile.PointList) error {
+	return firstError(pointListDiagnostics(pointList))
+}
+
+func firstError(diags []Diagnostic) error {
+	for _, d := range diags {
+		if d.Severity == SeverityError {
+			return fmt.Errorf("%s", d.Message)
+		}
+	}
+	return nil
+}
+
+// validateImage checks if a compressed image can be decoded. Raw images are not checked.
+func validateImage(img rexfile.Image) error {
+
+	if img.Compression != rexfile.Jpeg && img.Compression != rexfile.Png {
+		return nil
+	}
+	if _, _, err := image.DecodeConfig(bytes.NewReader(img.Data)); err != nil {
+		return fmt.Errorf("cannot decode image: %v", err)
+	}
+	return nil
+}
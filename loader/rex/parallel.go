@@ -0,0 +1,100 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rex
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/breiting/g3next/geom"
+	"github.com/g3n/engine/geometry"
+	"github.com/roboticeyes/gorexfile/encoding/rexfile"
+)
+
+// addMeshes adds all meshes like addMesh, but they are built in a single
+// batch. The first failing mesh stops adding, the meshes before it are placed
+// nevertheless.
+func (b *sceneBuilder) addMeshes(meshes []rexfile.Mesh, check func(id uint64, err error) error) error {
+
+	var failed error
+	for _, mesh := range meshes {
+		data, ok, err := b.prepareMesh(mesh)
+		if err := check(mesh.ID, err); err != nil {
+			failed = err
+			break
+		}
+		if ok {
+			b.batch = append(b.batch, data)
+		}
+	}
+	b.flush()
+	return failed
+}
+
+// flush builds the geometries of all queued meshes with the worker pool and
+// places the meshes on the calling goroutine in the order they were added
+func (b *sceneBuilder) flush() {
+
+	if len(b.batch) == 0 {
+		return
+	}
+	geometries := buildGeometries(b.batch, b.opts.Concurrency)
+	for i, data := range b.batch {
+		b.placeMesh(data, geometries[i])
+	}
+	b.batch = nil
+}
+
+// batchSize returns the number of streamed meshes which are built together.
+// Several meshes per worker keep all workers busy, without delaying the
+// nodes too long.
+func batchSize(workers int) int {
+
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers == 1 {
+		return 1
+	}
+	return 4 * workers
+}
+
+// buildGeometries builds the geometries of the meshes with the given number
+// of goroutines, GOMAXPROCS if it is not positive
+func buildGeometries(meshes []rexfile.Mesh, workers int) []*geometry.Geometry {
+
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(meshes) {
+		workers = len(meshes)
+	}
+
+	geometries := make([]*geometry.Geometry, len(meshes))
+	if workers <= 1 {
+		for i, mesh := range meshes {
+			geometries[i] = geom.NewRexMeshGeometry(mesh)
+		}
+		return geometries
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				geometries[i] = geom.NewRexMeshGeometry(meshes[i])
+			}
+		}()
+	}
+	for i := range meshes {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return geometries
+}
@@ -0,0 +1,142 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rex
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/g3n/engine/core"
+	"github.com/g3n/engine/gls"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/roboticeyes/gorexfile/encoding/rexfile"
+)
+
+// gridMesh returns a wavy grid without normals, so that the normals have to
+// be computed while loading
+func gridMesh(id, materialID uint64, size int) rexfile.Mesh {
+
+	mesh := rexfile.Mesh{
+		ID:         id,
+		Name:       fmt.Sprintf("grid-%d", id),
+		MaterialID: materialID,
+	}
+	for y := 0; y <= size; y++ {
+		for x := 0; x <= size; x++ {
+			z := float32((x*7+y*3)%5) * 0.1
+			mesh.Coords = append(mesh.Coords, mgl32.Vec3{float32(x), float32(y), z})
+		}
+	}
+	row := uint32(size + 1)
+	for y := uint32(0); y < uint32(size); y++ {
+		for x := uint32(0); x < uint32(size); x++ {
+			i := y*row + x
+			mesh.Triangles = append(mesh.Triangles,
+				rexfile.Triangle{V0: i, V1: i + 1, V2: i + row + 1},
+				rexfile.Triangle{V0: i, V1: i + row + 1, V2: i + row})
+		}
+	}
+	return mesh
+}
+
+// syntheticFile returns a file with the given number of meshes sharing a material
+func syntheticFile(meshes, size int) *rexfile.File {
+
+	file := &rexfile.File{Materials: []rexfile.Material{rexfile.NewMaterial(0)}}
+	for i := 1; i <= meshes; i++ {
+		file.Meshes = append(file.Meshes, gridMesh(uint64(i), 0, size))
+	}
+	return file
+}
+
+func TestParallelStream(t *testing.T) {
+
+	data := encodeFile(t, syntheticFile(50, 4), DefaultCRS)
+
+	// material and scene node blocks between the meshes flush the batch
+	node := rexfile.NewSceneNode(100, 3, "placed")
+	material := rexfile.NewMaterial(0)
+	first, second := gridMesh(1, 0, 4), gridMesh(2, 0, 4)
+	third := gridMesh(3, 0, 4)
+	mixed := encodeBlocks(t, &first, &material, &second, &node, &third)
+
+	tests := []struct {
+		name        string
+		data        []byte
+		concurrency int
+		names       []string
+	}{
+		{"sequential", data, 1, nil},
+		{"two workers", data, 2, nil},
+		{"default", data, 0, nil},
+		{"mixed sequential", mixed, 1, []string{"grid-1", "grid-2", "placed"}},
+		{"mixed default", mixed, 0, []string{"grid-1", "grid-2", "placed"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			var nodes []core.INode
+			dec := NewDecoderReader(bytes.NewReader(tt.data))
+			dec.SetOptions(LoadOptions{Concurrency: tt.concurrency})
+			group := core.NewNode()
+			if err := dec.Stream(group, func(node core.INode) { nodes = append(nodes, node) }, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			// scene nodes rename the meshes, therefore the names are taken afterwards
+			var added []string
+			for _, node := range nodes {
+				added = append(added, node.GetNode().Name())
+			}
+
+			names := tt.names
+			if names == nil {
+				for i := 1; i <= 50; i++ {
+					names = append(names, fmt.Sprintf("grid-%d", i))
+				}
+			}
+			if len(added) != len(names) {
+				t.Fatalf("added %v, want %v", added, names)
+			}
+			for i := range names {
+				if added[i] != names[i] {
+					t.Fatalf("added %v, want %v", added, names)
+				}
+			}
+			for _, child := range group.Children() {
+				if ToMesh(child).GetGeometry().VBO(gls.VertexNormal) == nil {
+					t.Errorf("%s has no normals", child.GetNode().Name())
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkLoad500Meshes(b *testing.B) {
+
+	file := syntheticFile(500, 30)
+	data := encodeFile(b, file, DefaultCRS)
+
+	for _, concurrency := range []int{1, 0} {
+		b.Run(fmt.Sprintf("stream/concurrency=%d", concurrency), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				dec := NewDecoderReader(bytes.NewReader(data))
+				dec.SetOptions(LoadOptions{Concurrency: concurrency})
+				if _, err := dec.NewGroup("bench"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("decoded/concurrency=%d", concurrency), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, _, err := CreateRexNodeOptions(file, "bench", LoadOptions{Concurrency: concurrency}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -6,22 +6,34 @@ package rex
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"os"
 
-	"github.com/breiting/g3next/entity"
-	"github.com/breiting/g3next/geom"
 	"github.com/g3n/engine/core"
-	"github.com/g3n/engine/graphic"
-	"github.com/g3n/engine/material"
-	"github.com/g3n/engine/math32"
 	"github.com/roboticeyes/gorexfile/encoding/rexfile"
 )
 
+// REX data block types
+const (
+	TypeLineSet   = 0
+	TypeText      = 1
+	TypePointList = 2
+	TypeMesh      = 3
+	TypeImage     = 4
+	TypeMaterial  = 5
+	TypeSceneNode = 6
+	TypeTrack     = 7
+)
+
 // Decoder is the REX file decoder
 type Decoder struct {
-	r io.Reader
+	r      io.Reader
+	size   int64 // size of the REX file in bytes, 0 if unknown
+	opts   LoadOptions
+	report *LoadReport
+	source string // file name, empty if read from a reader
 }
 
 // NewDecoder opens the reader and prepares everything for building the scene graph
@@ -35,113 +47,141 @@ func NewDecoder(rexFile string) (*Decoder, error) {
 
 	r := bufio.NewReader(file)
 
-	return &Decoder{r: r}, nil
+	var size int64
+	if info, err := file.Stat(); err == nil {
+		size = info.Size()
+	}
+
+	return &Decoder{r: r, size: size, source: rexFile}, nil
 }
 
 // NewDecoderReader creates a decoder with a reader
 func NewDecoderReader(r io.Reader) *Decoder {
+
+	var size int64
+	if l, ok := r.(interface{ Len() int }); ok {
+		size = int64(l.Len())
+	}
+
 	return &Decoder{
-		r: r,
+		r:    r,
+		size: size,
 	}
 }
 
+// SetOptions sets the options used for building the scene graph
+func (dec *Decoder) SetOptions(opts LoadOptions) {
+	dec.opts = opts
+}
+
+// Report returns the report of the last decoding, nil if nothing was decoded yet
+func (dec *Decoder) Report() *LoadReport {
+	return dec.report
+}
+
 // NewGroup creates and returns a group containing as children meshes.
-// A group is returned even if there is only one object decoded.
+// A group is returned even if there is only one object decoded. The
+// georeference of the file is available with GeoreferenceOf.
+//
+// If the file cannot be decoded completely, the group contains all nodes
+// decoded so far and a *DecodeError is returned. Truncated files are
+// reported with an error matching ErrTruncated.
 func (dec *Decoder) NewGroup(name string) (*core.Node, error) {
+	return dec.NewGroupContext(context.Background(), name)
+}
 
-	d := rexfile.NewDecoder(dec.r)
-	_, rex, err := d.Decode()
+// NewGroupContext is like NewGroup but the decoding can be cancelled with the
+// context. If the context is done before the file is decoded completely, the
+// context error is returned.
+func (dec *Decoder) NewGroupContext(ctx context.Context, name string) (*core.Node, error) {
 
-	if err != nil && err.Error() != "unexpected EOF" {
-		return core.NewNode(), fmt.Errorf("Cannot decode REX file: %v", err)
-	}
-	if rex == nil {
-		return core.NewNode(), fmt.Errorf("Nothing to decode: %v", err)
-	}
+	group := core.NewNode()
+	group.SetName(name)
 
-	return CreateRexNode(rex, name)
+	if err := dec.StreamContext(ctx, group, nil, nil); err != nil {
+		if err == ctx.Err() {
+			return core.NewNode(), err
+		}
+		return group, err
+	}
+	return group, nil
 }
 
+// CreateRexNode builds the scene graph for an already decoded REX file
 func CreateRexNode(rex *rexfile.File, name string) (*core.Node, error) {
+	group, _, err := CreateRexNodeOptions(rex, name, LoadOptions{})
+	return group, err
+}
 
-	var meshes []*entity.RexMesh
+// CreateRexNodeOptions builds the scene graph for an already decoded REX file
+// with the given options. In lenient mode invalid blocks are skipped and
+// listed in the report, otherwise the first invalid block stops building and
+// the group created so far is returned together with the error. Scene nodes
+// without mesh are always listed in the report.
+func CreateRexNodeOptions(rex *rexfile.File, name string, opts LoadOptions) (*core.Node, *LoadReport, error) {
 
 	group := core.NewNode()
 	group.SetName(name)
 
-	for _, mesh := range rex.Meshes {
-		meshes = append(meshes, entity.NewRexMesh(mesh))
+	report := &LoadReport{}
+	b := newSceneBuilder(group, nil, opts, report)
+	if opts.CRS != nil {
+		b.setCRS(*opts.CRS)
+	} else {
+		b.setCRS(CRS{}) // the decoded file does not keep the header
 	}
+	b.expectSceneNodes(rex.SceneNodes)
+	defer b.finish()
 
-	for _, mat := range rex.Materials {
-		for _, v := range meshes {
-			v.OfferMaterial(mat)
+	check := func(typ uint16, id uint64, err error) error {
+		if err == nil {
+			return nil
+		}
+		if opts.Lenient {
+			report.Skipped = append(report.Skipped, SkippedBlock{Type: typ, ID: id, Err: err})
+			return nil
 		}
+		return fmt.Errorf("Cannot create %s %d: %w", blockTypeName(typ), id, err)
+	}
+
+	checkMesh := func(id uint64, err error) error {
+		return check(TypeMesh, id, err)
+	}
+	if err := b.addMeshes(rex.Meshes, checkMesh); err != nil {
+		return group, report, err
+	}
+
+	for _, mat := range rex.Materials {
+		b.addMaterial(mat)
 	}
 
 	for _, img := range rex.Images {
-		for _, v := range meshes {
-			v.OfferTexture(img)
+		if err := check(TypeImage, img.ID, b.addImage(img)); err != nil {
+			return group, report, err
 		}
 	}
 
-	for _, m := range meshes {
-		// IMPORTANT: do not directly add the wrapped object, but only the embedded Mesh,
-		// otherwise the collider is not working!
-		group.Add(m.Mesh)
+	for _, node := range rex.SceneNodes {
+		b.addSceneNode(node)
 	}
 
 	for _, pointList := range rex.PointLists {
-		var mat material.IMaterial
-		if len(pointList.Colors) > 0 {
-			mat = material.NewBasic()
-		} else {
-			mat = material.NewStandard(&math32.Color{R: 0.42, G: 0.64, B: 0.42})
+		if err := check(TypePointList, pointList.ID, b.addPointList(pointList)); err != nil {
+			return group, report, err
 		}
-		points := graphic.NewPoints(geom.NewRexPointGeometry(pointList), mat)
-		group.Add(points)
 	}
 
 	for _, track := range rex.Tracks {
-		mat := material.NewStandard(&math32.Color{R: 0, G: 1, B: 0})
-		lines := graphic.NewLineStrip(geom.NewRexTrackGeometry(track), mat)
-		group.Add(lines)
+		b.addTrack(track)
 	}
 
 	for _, ls := range rex.LineSets {
-		fmt.Println(ls.Colors)
-		mat := material.NewStandard(&math32.Color{R: ls.Colors.X(), G: ls.Colors.Y(), B: ls.Colors.Z()})
-		lines := graphic.NewLineStrip(geom.NewRexLineSetGeometry(ls), mat)
-		group.Add(lines)
-	}
-
-	// TODO currently unsupported
-	// if len(rex.SceneNodes) > 0 {
-	// 	for _, node := range rex.SceneNodes {
-	//
-	// 		geom, ok := meshGeometries[node.GeometryID]
-	// 		if !ok {
-	// 			panic("Mesh not found")
-	// 		}
-	//
-	// 		var mat material.IMaterial
-	// 		mat, ok = rexMaterials[rex.Meshes[node.GeometryID].MaterialID]
-	// 		if !ok {
-	// 			mat = material.NewStandard(&math32.Color{R: 0.5, G: 0.2, B: 0})
-	// 		}
-	//
-	// 		mesh := graphic.NewMesh(geom, mat)
-	// 		if rex.Meshes[node.GeometryID].Name == "" {
-	// 			mesh.SetName(fmt.Sprintf("scenenode-%d", node.ID))
-	// 		} else {
-	// 			mesh.SetName(rex.Meshes[node.GeometryID].Name)
-	// 		}
-	// 		mesh.SetPosition(node.Translation.X(), node.Translation.Y(), node.Translation.Z())
-	// 		mesh.SetScale(node.Scale.X(), node.Scale.Y(), node.Scale.Z())
-	// 		mesh.SetQuaternion(node.Rotation.X(), node.Rotation.Y(), node.Rotation.Z(), node.Rotation.W())
-	// 		group.Add(mesh)
-	// 	}
-	// }
+		b.addLineSet(ls)
+	}
 
-	return group, nil
+	for _, text := range rex.Texts {
+		b.addText(text)
+	}
+
+	return group, report, nil
 }
@@ -0,0 +1,223 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rex
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/g3n/engine/core"
+	"github.com/roboticeyes/gorexfile/encoding/rexfile"
+)
+
+// Progress describes the state of a streaming decode after a data block has been read
+type Progress struct {
+	BytesRead  int64  // number of bytes read so far
+	TotalBytes int64  // size of the REX file, 0 if unknown
+	BlockType  uint16 // type of the data block just read
+	BlockID    uint64 // ID of the data block just read
+}
+
+// ProgressFunc is called after every data block during a streaming decode
+type ProgressFunc func(p Progress)
+
+// countingReader counts the bytes read from the underlying reader and stops
+// reading as soon as the context is done
+type countingReader struct {
+	r   io.Reader
+	n   int64
+	eof bool // the underlying reader reached its end
+	ctx context.Context
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		c.eof = true
+	}
+	return n, err
+}
+
+// Stream decodes the REX file block by block and adds the created nodes to
+// the group as soon as their data block has been read. Consecutive meshes are
+// built together by a pool of workers (see LoadOptions.Concurrency), they are
+// added when the batch is complete or another block type follows. Materials,
+// images and scene nodes are applied to the meshes which are already in the group.
+// onNode is called for every node added to the group and onProgress after
+// every data block, both may be nil. The options set with SetOptions are applied.
+func (dec *Decoder) Stream(group *core.Node, onNode NodeFunc, onProgress ProgressFunc) error {
+	return dec.StreamContext(context.Background(), group, onNode, onProgress)
+}
+
+// StreamContext is like Stream but stops decoding as soon as the context is
+// done. In this case the context error is returned and the group only contains
+// the nodes created so far.
+//
+// Decoding errors are returned as *DecodeError, truncated files in addition
+// match ErrTruncated.
+func (dec *Decoder) StreamContext(ctx context.Context, group *core.Node, onNode NodeFunc, onProgress ProgressFunc) error {
+
+	r := &countingReader{r: dec.r, ctx: ctx}
+
+	header, crs, err := ReadHeader(r)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	} else if err != nil {
+		return newDecodeError(r, headerBlock, rexfile.DataBlockHeader{}, err)
+	}
+
+	total := dec.size
+	if total == 0 {
+		total = int64(header.StartAddr) + int64(header.SizeBytes)
+	}
+
+	dec.report = &LoadReport{}
+
+	b := newSceneBuilder(group, onNode, dec.opts, dec.report)
+	b.ctx = ctx
+	b.source = dec.source
+	b.setCRS(crs)
+	defer b.finish()
+
+	for block := 0; ; block++ {
+		hdr, err := rexfile.ReadDataBlockHeader(r)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		} else if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return newDecodeError(r, block, hdr, err)
+		}
+
+		// meshes are built in batches, all other blocks may refer to them
+		if hdr.Type != TypeMesh {
+			b.flush()
+		}
+
+		start := r.n
+		if err := readBlock(r, hdr, b); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			decErr := newDecodeError(r, block, hdr, err)
+			if !dec.opts.Lenient {
+				return decErr
+			}
+
+			dec.report.Skipped = append(dec.report.Skipped, SkippedBlock{Type: hdr.Type, ID: hdr.ID, Err: decErr})
+			if r.eof {
+				return nil
+			}
+			// continue with the next block if the failing one was not read completely
+			if rest := int64(hdr.Size) - (r.n - start); rest > 0 {
+				if _, err := io.CopyN(ioutil.Discard, r, rest); err != nil {
+					return newDecodeError(r, block, hdr, err)
+				}
+			}
+		}
+
+		if onProgress != nil {
+			onProgress(Progress{
+				BytesRead:  r.n,
+				TotalBytes: total,
+				BlockType:  hdr.Type,
+				BlockID:    hdr.ID,
+			})
+		}
+	}
+}
+
+func newDecodeError(r *countingReader, block int, hdr rexfile.DataBlockHeader, err error) *DecodeError {
+	return &DecodeError{
+		Block:     block,
+		Type:      hdr.Type,
+		ID:        hdr.ID,
+		Offset:    r.n,
+		Truncated: r.eof,
+		Err:       err,
+	}
+}
+
+// readBlock reads the data block with the given header and passes it to the builder
+func readBlock(r io.Reader, hdr rexfile.DataBlockHeader, b *sceneBuilder) error {
+
+	// skip filtered blocks without decoding them, track and scene node blocks
+	// written by gorexfile carry a wrong size and are therefore always decoded
+	filter := &b.opts.Filter
+	if hdr.Type != TypeTrack && hdr.Type != TypeSceneNode && hdr.Type <= TypeTrack {
+		if !filter.acceptType(hdr.Type) || (hdr.Type == TypeMesh && !filter.acceptMeshID(hdr.ID)) {
+			if hdr.Type == TypeMesh {
+				b.skipMesh(hdr.ID)
+			}
+			_, err := io.CopyN(ioutil.Discard, r, int64(hdr.Size))
+			return err
+		}
+	}
+
+	switch hdr.Type {
+	case TypeLineSet:
+		ls, err := rexfile.ReadLineSet(r, hdr)
+		if err != nil {
+			return err
+		}
+		b.addLineSet(*ls)
+	case TypeText:
+		text, err := rexfile.ReadText(r, hdr)
+		if err != nil {
+			return err
+		}
+		text.ID = hdr.ID
+		b.addText(*text)
+	case TypePointList:
+		pointList, err := rexfile.ReadPointList(r, hdr)
+		if err != nil {
+			return err
+		}
+		return b.addPointList(*pointList)
+	case TypeMesh:
+		mesh, err := rexfile.ReadMesh(r, hdr)
+		if err != nil {
+			return err
+		}
+		return b.addMesh(*mesh)
+	case TypeImage:
+		img, err := rexfile.ReadImage(r, hdr)
+		if err != nil {
+			return err
+		}
+		return b.addImage(*img)
+	case TypeMaterial:
+		mat, err := rexfile.ReadMaterial(r, hdr)
+		if err != nil {
+			return err
+		}
+		b.addMaterial(*mat)
+	case TypeSceneNode:
+		node, err := rexfile.ReadSceneNode(r, hdr)
+		if err != nil {
+			return err
+		}
+		b.addSceneNode(*node)
+	case TypeTrack:
+		track, err := rexfile.ReadTrack(r, hdr)
+		if err != nil {
+			return err
+		}
+		track.ID = hdr.ID
+		b.addTrack(*track)
+	default:
+		fmt.Printf("WARNING: Skipping type %d version %d sz %d id %d\n", hdr.Type, hdr.Version, hdr.Size, hdr.ID)
+		if _, err := io.CopyN(ioutil.Discard, r, int64(hdr.Size)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
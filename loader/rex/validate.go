@@ -0,0 +1,240 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rex
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/roboticeyes/gorexfile/encoding/rexfile"
+)
+
+// Severity of a diagnostic
+type Severity int
+
+const (
+	// SeverityWarning marks data which is loaded but most likely not shown as intended
+	SeverityWarning Severity = iota
+	// SeverityError marks data which cannot be loaded
+	SeverityError
+)
+
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "error"
+	}
+	return "warning"
+}
+
+// DiagnosticCode identifies the kind of problem found by Validate
+type DiagnosticCode string
+
+// Diagnostic codes reported by Validate
+const (
+	CodeIndexOutOfRange   DiagnosticCode = "index-out-of-range"
+	CodeColorCount        DiagnosticCode = "color-count"
+	CodeTexCoordCount     DiagnosticCode = "texcoord-count"
+	CodeMissingMaterial   DiagnosticCode = "missing-material"
+	CodeMissingTexture    DiagnosticCode = "missing-texture"
+	CodeMissingGeometry   DiagnosticCode = "missing-geometry"
+	CodeDuplicateID       DiagnosticCode = "duplicate-id"
+	CodeInvalidCoordinate DiagnosticCode = "invalid-coordinate"
+	CodeEmptyMesh         DiagnosticCode = "empty-mesh"
+)
+
+// Diagnostic describes a problem of a single data block
+type Diagnostic struct {
+	Severity Severity
+	Code     DiagnosticCode
+	Type     uint16 // type of the data block
+	ID       uint64 // ID of the data block
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s %d: %s (%s)", d.Severity, blockTypeName(d.Type), d.ID, d.Message, d.Code)
+}
+
+// Validate checks the REX file for everything the scene graph creation relies
+// on and returns all problems found. The result is empty for a valid file.
+func Validate(rex *rexfile.File) []Diagnostic {
+
+	var diags []Diagnostic
+
+	materials := make(map[uint64]bool)
+	for _, mat := range rex.Materials {
+		materials[mat.ID] = true
+	}
+	images := make(map[uint64]bool)
+	for _, img := range rex.Images {
+		images[img.ID] = true
+	}
+	meshes := make(map[uint64]bool)
+	for _, mesh := range rex.Meshes {
+		meshes[mesh.ID] = true
+	}
+
+	ids := make(map[uint64]uint16)
+	checkID := func(typ uint16, id uint64) {
+		if other, ok := ids[id]; ok {
+			diags = append(diags, Diagnostic{
+				Severity: SeverityWarning,
+				Code:     CodeDuplicateID,
+				Type:     typ,
+				ID:       id,
+				Message:  fmt.Sprintf("ID is already used by a %s block", blockTypeName(other)),
+			})
+			return
+		}
+		ids[id] = typ
+	}
+
+	for _, mesh := range rex.Meshes {
+		checkID(TypeMesh, mesh.ID)
+		diags = append(diags, meshDiagnostics(mesh)...)
+		if mesh.MaterialID != rexfile.NotSpecified && !materials[mesh.MaterialID] {
+			diags = append(diags, Diagnostic{
+				Severity: SeverityWarning,
+				Code:     CodeMissingMaterial,
+				Type:     TypeMesh,
+				ID:       mesh.ID,
+				Message:  fmt.Sprintf("material %d does not exist", mesh.MaterialID),
+			})
+		}
+	}
+
+	for _, mat := range rex.Materials {
+		checkID(TypeMaterial, mat.ID)
+		if mat.KdTextureID != rexfile.NotSpecified && !images[mat.KdTextureID] {
+			diags = append(diags, Diagnostic{
+				Severity: SeverityWarning,
+				Code:     CodeMissingTexture,
+				Type:     TypeMaterial,
+				ID:       mat.ID,
+				Message:  fmt.Sprintf("diffuse texture %d does not exist", mat.KdTextureID),
+			})
+		}
+	}
+
+	for _, img := range rex.Images {
+		checkID(TypeImage, img.ID)
+	}
+
+	for _, node := range rex.SceneNodes {
+		checkID(TypeSceneNode, node.ID)
+		if !meshes[node.GeometryID] {
+			diags = append(diags, Diagnostic{
+				Severity: SeverityWarning,
+				Code:     CodeMissingGeometry,
+				Type:     TypeSceneNode,
+				ID:       node.ID,
+				Message:  fmt.Sprintf("mesh %d does not exist", node.GeometryID),
+			})
+		}
+		diags = append(diags, coordinateDiagnostics(TypeSceneNode, node.ID, []mgl32.Vec3{node.Translation, node.Scale})...)
+	}
+
+	for _, pointList := range rex.PointLists {
+		checkID(TypePointList, pointList.ID)
+		diags = append(diags, pointListDiagnostics(pointList)...)
+	}
+
+	for _, ls := range rex.LineSets {
+		checkID(TypeLineSet, ls.ID)
+		diags = append(diags, coordinateDiagnostics(TypeLineSet, ls.ID, ls.Points)...)
+	}
+
+	for _, track := range rex.Tracks {
+		// track IDs are not stored by all writers, therefore they are not checked for duplicates
+		points := make([]mgl32.Vec3, len(track.Points))
+		for i, p := range track.Points {
+			points[i] = p.Point
+		}
+		diags = append(diags, coordinateDiagnostics(TypeTrack, track.ID, points)...)
+	}
+
+	// text IDs are not set by rexfile.ReadText, therefore they are not checked for duplicates
+	for _, text := range rex.Texts {
+		diags = append(diags, coordinateDiagnostics(TypeText, text.ID, []mgl32.Vec3{text.Position})...)
+	}
+
+	return diags
+}
+
+// meshDiagnostics checks a single mesh datablock
+func meshDiagnostics(mesh rexfile.Mesh) []Diagnostic {
+
+	var diags []Diagnostic
+	add := func(severity Severity, code DiagnosticCode, format string, args ...interface{}) {
+		diags = append(diags, Diagnostic{
+			Severity: severity,
+			Code:     code,
+			Type:     TypeMesh,
+			ID:       mesh.ID,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	if len(mesh.Coords) == 0 || len(mesh.Triangles) == 0 {
+		add(SeverityWarning, CodeEmptyMesh, "mesh has %d coordinates and %d triangles", len(mesh.Coords), len(mesh.Triangles))
+	}
+
+	nrCoords := uint32(len(mesh.Coords))
+triangles:
+	for i, t := range mesh.Triangles {
+		for _, v := range []uint32{t.V0, t.V1, t.V2} {
+			if v >= nrCoords {
+				add(SeverityError, CodeIndexOutOfRange, "triangle %d references vertex %d, mesh has %d coordinates", i, v, nrCoords)
+				break triangles
+			}
+		}
+	}
+
+	if len(mesh.Colors) > 0 && len(mesh.Colors) != len(mesh.Coords) {
+		add(SeverityError, CodeColorCount, "mesh has %d colors for %d coordinates", len(mesh.Colors), len(mesh.Coords))
+	}
+	if len(mesh.TexCoords) > 0 && len(mesh.TexCoords) != len(mesh.Coords) {
+		add(SeverityError, CodeTexCoordCount, "mesh has %d texture coordinates for %d coordinates", len(mesh.TexCoords), len(mesh.Coords))
+	}
+
+	return append(diags, coordinateDiagnostics(TypeMesh, mesh.ID, mesh.Coords)...)
+}
+
+// pointListDiagnostics checks a single point list datablock
+func pointListDiagnostics(pointList rexfile.PointList) []Diagnostic {
+
+	var diags []Diagnostic
+	if len(pointList.Colors) > 0 && len(pointList.Colors) != len(pointList.Points) {
+		diags = append(diags, Diagnostic{
+			Severity: SeverityError,
+			Code:     CodeColorCount,
+			Type:     TypePointList,
+			ID:       pointList.ID,
+			Message:  fmt.Sprintf("point list has %d colors for %d points", len(pointList.Colors), len(pointList.Points)),
+		})
+	}
+	return append(diags, coordinateDiagnostics(TypePointList, pointList.ID, pointList.Points)...)
+}
+
+// coordinateDiagnostics reports the first coordinate which is NaN or infinite
+func coordinateDiagnostics(typ uint16, id uint64, coords []mgl32.Vec3) []Diagnostic {
+
+	for i, c := range coords {
+		for _, v := range c {
+			f := float64(v)
+			if math.IsNaN(f) || math.IsInf(f, 0) {
+				return []Diagnostic{{
+					Severity: SeverityWarning,
+					Code:     CodeInvalidCoordinate,
+					Type:     typ,
+					ID:       id,
+					Message:  fmt.Sprintf("coordinate %d is %v", i, c),
+				}}
+			}
+		}
+	}
+	return nil
+}
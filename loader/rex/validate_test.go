@@ -0,0 +1,99 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rex
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/roboticeyes/gorexfile/encoding/rexfile"
+)
+
+func TestValidate(t *testing.T) {
+
+	nan := float32(math.NaN())
+	broken := cube(2, rexfile.NotSpecified, "broken", 1)
+	broken.Triangles = append(broken.Triangles, rexfile.Triangle{V0: 0, V1: 1, V2: 100})
+
+	tests := []struct {
+		name  string
+		file  rexfile.File
+		codes []DiagnosticCode
+	}{
+		{
+			name: "valid",
+			file: rexfile.File{Meshes: []rexfile.Mesh{cube(1, rexfile.NotSpecified, "box", 1)}},
+		},
+		{
+			name:  "missing material",
+			file:  rexfile.File{Meshes: []rexfile.Mesh{cube(1, 10, "box", 1)}},
+			codes: []DiagnosticCode{CodeMissingMaterial},
+		},
+		{
+			name:  "index out of range",
+			file:  rexfile.File{Meshes: []rexfile.Mesh{broken}},
+			codes: []DiagnosticCode{CodeIndexOutOfRange},
+		},
+		{
+			name: "duplicate ID",
+			file: rexfile.File{
+				Meshes:    []rexfile.Mesh{cube(1, rexfile.NotSpecified, "box", 1)},
+				Materials: []rexfile.Material{rexfile.NewMaterial(1)},
+			},
+			codes: []DiagnosticCode{CodeDuplicateID},
+		},
+		{
+			name: "missing geometry",
+			file: rexfile.File{
+				SceneNodes: []rexfile.SceneNode{rexfile.NewSceneNode(1, 5, "node")},
+			},
+			codes: []DiagnosticCode{CodeMissingGeometry},
+		},
+		{
+			name: "texts without ID",
+			file: rexfile.File{
+				Meshes: []rexfile.Mesh{cube(0, rexfile.NotSpecified, "box", 1)},
+				Texts:  []rexfile.Text{{Text: "a"}, {Text: "b"}},
+			},
+		},
+		{
+			name:  "invalid text position",
+			file:  rexfile.File{Texts: []rexfile.Text{{Position: mgl32.Vec3{nan, 0, 0}, Text: "a"}}},
+			codes: []DiagnosticCode{CodeInvalidCoordinate},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diags := Validate(&tt.file)
+			if len(diags) != len(tt.codes) {
+				t.Fatalf("got %v, want %v", diags, tt.codes)
+			}
+			for i, d := range diags {
+				if d.Code != tt.codes[i] {
+					t.Errorf("diagnostic %d is %v, want %s", i, d, tt.codes[i])
+				}
+			}
+		})
+	}
+}
+
+// TestValidateDecodedTexts checks texts read with rexfile.Decoder, which
+// leaves all text IDs at 0
+func TestValidateDecodedTexts(t *testing.T) {
+
+	file := rexfile.File{
+		Texts: []rexfile.Text{{ID: 1, Alpha: 1, Text: "a"}, {ID: 2, Alpha: 1, Text: "b"}},
+	}
+	_, decoded, err := rexfile.NewDecoder(bytes.NewReader(encodeFile(t, &file, DefaultCRS))).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diags := Validate(decoded); len(diags) != 0 {
+		t.Errorf("got %v, want no diagnostics", diags)
+	}
+}
@@ -0,0 +1,382 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package stl writes node trees as binary or ASCII STL files, e.g. for 3D
+// printing. Only meshes are exported, point lists, lines and labels are
+// skipped.
+package stl
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/breiting/g3next/loader/rex"
+	"github.com/g3n/engine/core"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/roboticeyes/gorexfile/encoding/rexfile"
+)
+
+// MetersToMillimeters is the scale for converting scenes in meters into
+// millimeters, the common unit of slicers
+const MetersToMillimeters = 1000
+
+// DefaultTolerance is the weld distance in scene units if none is set
+const DefaultTolerance = 1e-4
+
+// Options control how the triangles are written
+type Options struct {
+	// ASCII writes the text format instead of the binary format
+	ASCII bool
+	// Scale is applied to all coordinates, 0 is the same as 1
+	Scale float32
+	// Weld merges vertices closer than Tolerance
+	Weld bool
+	// Tolerance is the weld distance in scene units (before scaling)
+	Tolerance float32
+	// Repair welds the vertices, removes degenerate and duplicate
+	// triangles and orients all triangles of a shell consistently outwards
+	Repair bool
+	// Coordinates converts the scene coordinates, e.g. into the z-up
+	// system expected by slicers
+	Coordinates rex.CoordinateConversion
+}
+
+// Encoder writes a node tree as STL file
+type Encoder struct {
+	w    io.Writer
+	opts Options
+}
+
+// NewEncoder creates an encoder writing binary STL data
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// SetOptions sets the options used for writing
+func (enc *Encoder) SetOptions(opts Options) {
+	enc.opts = opts
+}
+
+// Encode writes all meshes of the node tree. The world transforms are baked
+// into the coordinates, the transformation of the root node itself is not
+// exported (see rex.CreateRexFile).
+func (enc *Encoder) Encode(root core.INode) error {
+	return WriteSTL(enc.w, rex.CreateRexFile(root), "g3next", enc.opts)
+}
+
+// WriteSTL writes all meshes of the REX file as one solid with the given name
+func WriteSTL(w io.Writer, file *rexfile.File, name string, opts Options) error {
+
+	s := newSoup(file, opts.Coordinates)
+	if opts.Weld || opts.Repair {
+		tolerance := opts.Tolerance
+		if tolerance <= 0 {
+			tolerance = DefaultTolerance
+		}
+		s.weld(tolerance)
+	}
+	if opts.Repair {
+		s.removeDegenerate()
+		s.removeDuplicates()
+		s.orient()
+	}
+
+	scale := opts.Scale
+	if scale == 0 {
+		scale = 1
+	}
+	for i := range s.vertices {
+		s.vertices[i] = s.vertices[i].Mul(scale)
+	}
+	if scale < 0 {
+		s.flip()
+	}
+
+	bw := bufio.NewWriter(w)
+	var err error
+	if opts.ASCII {
+		err = s.writeASCII(bw, name)
+	} else {
+		err = s.writeBinary(bw, name)
+	}
+	if err != nil {
+		return fmt.Errorf("Cannot write STL data: %v", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("Cannot write STL data: %v", err)
+	}
+	return nil
+}
+
+// soup is an indexed triangle list of all meshes
+type soup struct {
+	vertices  []mgl32.Vec3
+	triangles [][3]uint32
+}
+
+func newSoup(file *rexfile.File, conv rex.CoordinateConversion) *soup {
+
+	// conversions into a system of different handedness mirror the triangles
+	x, y, z := conv.Apply(mgl32.Vec3{1, 0, 0}), conv.Apply(mgl32.Vec3{0, 1, 0}), conv.Apply(mgl32.Vec3{0, 0, 1})
+	mirror := x.Dot(y.Cross(z)) < 0
+
+	s := &soup{}
+	for _, mesh := range rex.BakeSceneNodes(file) {
+		offset := uint32(len(s.vertices))
+		n := uint32(len(mesh.Coords))
+		for _, v := range mesh.Coords {
+			s.vertices = append(s.vertices, conv.Apply(v))
+		}
+		for _, t := range mesh.Triangles {
+			if t.V0 >= n || t.V1 >= n || t.V2 >= n {
+				continue
+			}
+			if mirror {
+				t.V1, t.V2 = t.V2, t.V1
+			}
+			s.triangles = append(s.triangles, [3]uint32{t.V0 + offset, t.V1 + offset, t.V2 + offset})
+		}
+	}
+	return s
+}
+
+// weld merges each vertex into the first vertex closer than the tolerance.
+// The candidates are looked up in a grid of the tolerance size, therefore
+// only the neighbouring cells must be checked.
+func (s *soup) weld(tolerance float32) {
+
+	type cell [3]int64
+	cellOf := func(v mgl32.Vec3) cell {
+		return cell{
+			int64(math.Floor(float64(v[0] / tolerance))),
+			int64(math.Floor(float64(v[1] / tolerance))),
+			int64(math.Floor(float64(v[2] / tolerance))),
+		}
+	}
+	cells := make(map[cell][]uint32)
+	remap := make([]uint32, len(s.vertices))
+	var vertices []mgl32.Vec3
+
+	for i, v := range s.vertices {
+		c := cellOf(v)
+		idx, found := uint32(0), false
+		for dx := int64(-1); dx <= 1 && !found; dx++ {
+			for dy := int64(-1); dy <= 1 && !found; dy++ {
+				for dz := int64(-1); dz <= 1 && !found; dz++ {
+					for _, k := range cells[cell{c[0] + dx, c[1] + dy, c[2] + dz}] {
+						if vertices[k].Sub(v).Len() < tolerance {
+							idx, found = k, true
+							break
+						}
+					}
+				}
+			}
+		}
+		if !found {
+			idx = uint32(len(vertices))
+			cells[c] = append(cells[c], idx)
+			vertices = append(vertices, v)
+		}
+		remap[i] = idx
+	}
+
+	for i, t := range s.triangles {
+		s.triangles[i] = [3]uint32{remap[t[0]], remap[t[1]], remap[t[2]]}
+	}
+	s.vertices = vertices
+}
+
+// removeDegenerate removes triangles with collapsed vertices or without area
+func (s *soup) removeDegenerate() {
+
+	triangles := s.triangles[:0]
+	for _, t := range s.triangles {
+		if t[0] == t[1] || t[1] == t[2] || t[2] == t[0] {
+			continue
+		}
+		if s.normal(t).Len() == 0 {
+			continue
+		}
+		triangles = append(triangles, t)
+	}
+	s.triangles = triangles
+}
+
+// removeDuplicates keeps only the first triangle with the same vertices,
+// independent of their order
+func (s *soup) removeDuplicates() {
+
+	seen := make(map[[3]uint32]bool)
+	triangles := s.triangles[:0]
+	for _, t := range s.triangles {
+		key := t
+		if key[0] > key[1] {
+			key[0], key[1] = key[1], key[0]
+		}
+		if key[1] > key[2] {
+			key[1], key[2] = key[2], key[1]
+		}
+		if key[0] > key[1] {
+			key[0], key[1] = key[1], key[0]
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		triangles = append(triangles, t)
+	}
+	s.triangles = triangles
+}
+
+// orient flips triangles so that neighbours share their edges in opposite
+// direction. Closed shells with negative volume are turned inside out.
+// Non-manifold edges (more than two triangles) are not followed.
+func (s *soup) orient() {
+
+	type edge [2]uint32
+	key := func(a, b uint32) edge {
+		if a > b {
+			a, b = b, a
+		}
+		return edge{a, b}
+	}
+
+	adjacent := make(map[edge][]int)
+	for i, t := range s.triangles {
+		for k := 0; k < 3; k++ {
+			e := key(t[k], t[(k+1)%3])
+			adjacent[e] = append(adjacent[e], i)
+		}
+	}
+
+	// hasEdge reports whether the triangle contains the directed edge a->b
+	hasEdge := func(t [3]uint32, a, b uint32) bool {
+		for k := 0; k < 3; k++ {
+			if t[k] == a && t[(k+1)%3] == b {
+				return true
+			}
+		}
+		return false
+	}
+
+	visited := make([]bool, len(s.triangles))
+	for start := range s.triangles {
+		if visited[start] {
+			continue
+		}
+		visited[start] = true
+		shell := []int{start}
+		closed := true
+
+		for queue := []int{start}; len(queue) > 0; queue = queue[1:] {
+			t := s.triangles[queue[0]]
+			for k := 0; k < 3; k++ {
+				a, b := t[k], t[(k+1)%3]
+				neighbours := adjacent[key(a, b)]
+				if len(neighbours) != 2 {
+					closed = false
+					continue
+				}
+				for _, n := range neighbours {
+					if visited[n] {
+						continue
+					}
+					visited[n] = true
+					if hasEdge(s.triangles[n], a, b) {
+						nt := s.triangles[n]
+						s.triangles[n] = [3]uint32{nt[0], nt[2], nt[1]}
+					}
+					shell = append(shell, n)
+					queue = append(queue, n)
+				}
+			}
+		}
+
+		if !closed {
+			continue
+		}
+		var volume float32
+		for _, i := range shell {
+			t := s.triangles[i]
+			volume += s.vertices[t[0]].Dot(s.vertices[t[1]].Cross(s.vertices[t[2]]))
+		}
+		if volume < 0 {
+			for _, i := range shell {
+				t := s.triangles[i]
+				s.triangles[i] = [3]uint32{t[0], t[2], t[1]}
+			}
+		}
+	}
+}
+
+// flip reverses the orientation of all triangles
+func (s *soup) flip() {
+	for i, t := range s.triangles {
+		s.triangles[i] = [3]uint32{t[0], t[2], t[1]}
+	}
+}
+
+// normal returns the facet normal, zero for degenerate triangles
+func (s *soup) normal(t [3]uint32) mgl32.Vec3 {
+
+	v0, v1, v2 := s.vertices[t[0]], s.vertices[t[1]], s.vertices[t[2]]
+	n := v1.Sub(v0).Cross(v2.Sub(v0))
+	if l := n.Len(); l > 0 {
+		return n.Mul(1 / l)
+	}
+	return mgl32.Vec3{}
+}
+
+func (s *soup) writeBinary(w io.Writer, name string) error {
+
+	header := make([]byte, 80)
+	copy(header, name)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint32(len(s.triangles))); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 50)
+	for _, t := range s.triangles {
+		values := []mgl32.Vec3{s.normal(t), s.vertices[t[0]], s.vertices[t[1]], s.vertices[t[2]]}
+		for i, v := range values {
+			for k := 0; k < 3; k++ {
+				binary.LittleEndian.PutUint32(buf[(i*3+k)*4:], math.Float32bits(v[k]))
+			}
+		}
+		// attribute byte count is unused
+		binary.LittleEndian.PutUint16(buf[48:], 0)
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *soup) writeASCII(w io.Writer, name string) error {
+
+	if _, err := fmt.Fprintf(w, "solid %s\n", name); err != nil {
+		return err
+	}
+	for _, t := range s.triangles {
+		n := s.normal(t)
+		fmt.Fprintf(w, "  facet normal %e %e %e\n", n.X(), n.Y(), n.Z())
+		fmt.Fprintf(w, "    outer loop\n")
+		for _, i := range t {
+			v := s.vertices[i]
+			fmt.Fprintf(w, "      vertex %e %e %e\n", v.X(), v.Y(), v.Z())
+		}
+		fmt.Fprintf(w, "    endloop\n")
+		if _, err := fmt.Fprintf(w, "  endfacet\n"); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "endsolid %s\n", name)
+	return err
+}
@@ -0,0 +1,174 @@
+// Copyright 2020. Bernhard Reitinger. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/breiting/g3next/loader/rex"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/roboticeyes/gorexfile/encoding/rexfile"
+)
+
+// facet is a triangle with its normal as written to the file
+type facet [4]mgl32.Vec3
+
+func readBinary(t *testing.T, data []byte) []facet {
+
+	t.Helper()
+	if len(data) < 84 {
+		t.Fatalf("%d bytes, want at least the header", len(data))
+	}
+	n := int(binary.LittleEndian.Uint32(data[80:]))
+	if len(data) != 84+n*50 {
+		t.Fatalf("%d bytes for %d triangles", len(data), n)
+	}
+	facets := make([]facet, n)
+	for i := range facets {
+		for k := 0; k < 12; k++ {
+			facets[i][k/3][k%3] = math.Float32frombits(binary.LittleEndian.Uint32(data[84+i*50+k*4:]))
+		}
+	}
+	return facets
+}
+
+func readASCII(t *testing.T, data []byte, name string) []facet {
+
+	t.Helper()
+	var facets []facet
+	var f facet
+	var corner int
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		var v mgl32.Vec3
+		if len(fields) >= 3 {
+			for k := 0; k < 3; k++ {
+				x, _ := strconv.ParseFloat(fields[len(fields)-3+k], 32)
+				v[k] = float32(x)
+			}
+		}
+		switch fields[0] {
+		case "solid", "endsolid":
+			if len(fields) != 2 || fields[1] != name {
+				t.Errorf("got %q, want the solid %s", scanner.Text(), name)
+			}
+		case "facet":
+			f, corner = facet{v}, 1
+		case "vertex":
+			f[corner] = v
+			corner++
+		case "endfacet":
+			facets = append(facets, f)
+		}
+	}
+	return facets
+}
+
+// volume returns the signed volume enclosed by the facets and checks that
+// the normals match the winding
+func volume(t *testing.T, facets []facet) float32 {
+
+	t.Helper()
+	var v float32
+	for _, f := range facets {
+		v += f[1].Dot(f[2].Cross(f[3])) / 6
+		n := f[2].Sub(f[1]).Cross(f[3].Sub(f[1]))
+		if n.Len() > 0 && !n.Normalize().ApproxEqualThreshold(f[0], 1e-4) {
+			t.Errorf("normal is %v, want %v", f[0], n.Normalize())
+		}
+	}
+	return v
+}
+
+func cube() rexfile.Mesh {
+	mesh, _ := rexfile.NewCube(1, uint64(rexfile.NotSpecified), 2)
+	return mesh
+}
+
+// broken is the cube with a flipped, a duplicate and a degenerate triangle
+func broken() rexfile.Mesh {
+	mesh := cube()
+	t := mesh.Triangles[0]
+	mesh.Triangles[0] = rexfile.Triangle{V0: t.V0, V1: t.V2, V2: t.V1}
+	mesh.Triangles = append(mesh.Triangles, mesh.Triangles[1], rexfile.Triangle{V0: 0, V1: 0, V2: 1})
+	return mesh
+}
+
+func TestWriteSTL(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		mesh      rexfile.Mesh
+		opts      Options
+		triangles int
+		volume    float32 // 0 if not checked
+	}{
+		{"binary", cube(), Options{}, 12, 8},
+		{"ascii", cube(), Options{ASCII: true}, 12, 8},
+		{"millimeters", cube(), Options{Scale: MetersToMillimeters}, 12, 8e9},
+		{"mirrored by the scale", cube(), Options{Scale: -1}, 12, 8},
+		{"mirrored by the conversion", cube(), Options{Coordinates: rex.CoordinateConversion{From: rex.ZUpRightHanded, To: rex.ZUpLeftHanded}}, 12, 8},
+		{"broken", broken(), Options{}, 14, 0},
+		{"repaired", broken(), Options{Repair: true}, 12, 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			var buf bytes.Buffer
+			file := &rexfile.File{Meshes: []rexfile.Mesh{tt.mesh}}
+			if err := WriteSTL(&buf, file, "cube", tt.opts); err != nil {
+				t.Fatal(err)
+			}
+
+			var facets []facet
+			if tt.opts.ASCII {
+				facets = readASCII(t, buf.Bytes(), "cube")
+			} else {
+				facets = readBinary(t, buf.Bytes())
+			}
+			if len(facets) != tt.triangles {
+				t.Fatalf("%d triangles, want %d", len(facets), tt.triangles)
+			}
+			if tt.volume == 0 {
+				return
+			}
+			if v := volume(t, facets); math.Abs(float64(v-tt.volume)) > 1e-4*math.Max(1, float64(tt.volume)) {
+				t.Errorf("volume is %v, want %v", v, tt.volume)
+			}
+		})
+	}
+}
+
+func TestWeld(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		vertices []mgl32.Vec3
+		want     int
+	}{
+		{"across a cell border", []mgl32.Vec3{{0.49, 0, 0}, {0.51, 0, 0}}, 1},
+		{"within a cell but too far", []mgl32.Vec3{{0.51, 0.51, 0.51}, {1.49, 1.49, 1.49}}, 2},
+		{"chained", []mgl32.Vec3{{0, 0, 0}, {0.8, 0, 0}, {1.6, 0, 0}}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			s := &soup{vertices: tt.vertices}
+			s.weld(1)
+			if len(s.vertices) != tt.want {
+				t.Errorf("%d vertices after welding, want %d", len(s.vertices), tt.want)
+			}
+		})
+	}
+}
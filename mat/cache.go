@@ -0,0 +1,98 @@
+package mat
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/jpeg" // support jpeg
+	_ "image/png"  // support png
+
+	"github.com/g3n/engine/gls"
+	"github.com/g3n/engine/texture"
+	"github.com/roboticeyes/gorexfile/encoding/rexfile"
+)
+
+// Cache shares the materials and textures of one REX file between all meshes.
+// Every material is created and every image is decoded only once. The IDs
+// are only unique within one file, therefore a cache must not be used for
+// several files.
+type Cache struct {
+	materials map[uint64]*RexStandardMaterial
+	textures  map[uint64]*texture.Texture2D // nil if the image cannot be decoded
+	used      map[uint64]bool               // texture is already owned by a material
+}
+
+// NewCache creates an empty cache
+func NewCache() *Cache {
+	return &Cache{
+		materials: make(map[uint64]*RexStandardMaterial),
+		textures:  make(map[uint64]*texture.Texture2D),
+		used:      make(map[uint64]bool),
+	}
+}
+
+// Material returns the material for the REX material datablock, it is created
+// on first use. Every caller owns a reference of the returned material.
+func (c *Cache) Material(data rexfile.Material) *RexStandardMaterial {
+
+	if m, ok := c.materials[data.ID]; ok {
+		m.Incref()
+		return m
+	}
+	m := NewRexStandardMaterial(data)
+	c.materials[data.ID] = m
+	return m
+}
+
+// ApplyTexture adds the image as diffuse texture to the cached material with
+// the given ID. Nothing happens if the material has not been created yet or
+// already has a texture.
+func (c *Cache) ApplyTexture(materialID uint64, img rexfile.Image) {
+
+	m, ok := c.materials[materialID]
+	if !ok || m.Texture != nil {
+		return
+	}
+
+	tex, ok := c.textures[img.ID]
+	if !ok {
+		var err error
+		tex, err = NewRexTexture(img)
+		if err != nil {
+			fmt.Println(err)
+		}
+		c.textures[img.ID] = tex
+	}
+	if tex == nil {
+		return
+	}
+
+	if c.used[img.ID] {
+		tex.Incref()
+	}
+	c.used[img.ID] = true
+	m.AddTexture(tex)
+	m.Texture = &img
+}
+
+// NewRexTexture decodes the REX image datablock into a repeating texture
+func NewRexTexture(img rexfile.Image) (*texture.Texture2D, error) {
+
+	decodedImg, _, err := image.Decode(bytes.NewReader(img.Data))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot decode texture %d", img.ID)
+	}
+
+	// Converts image to RGBA format
+	rgba := image.NewRGBA(decodedImg.Bounds())
+	if rgba.Stride != rgba.Rect.Size().X*4 {
+		return nil, fmt.Errorf("Unsupported stride information for texture %d", img.ID)
+	}
+	draw.Draw(rgba, rgba.Bounds(), decodedImg, image.Point{0, 0}, draw.Src)
+
+	tex := texture.NewTexture2DFromRGBA(rgba)
+	tex.SetWrapS(gls.REPEAT)
+	tex.SetWrapT(gls.REPEAT)
+	return tex, nil
+}
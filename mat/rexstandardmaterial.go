@@ -6,8 +6,17 @@ import (
 	"github.com/roboticeyes/gorexfile/encoding/rexfile"
 )
 
+// RexStandardMaterial is a standard material which keeps the REX material
+// datablock it was created from, so that it can be written back to REX
+type RexStandardMaterial struct {
+	*material.Standard
+
+	Data    rexfile.Material
+	Texture *rexfile.Image // diffuse texture, nil if not set
+}
+
 // NewRexStandardMaterial generates a new material
-func NewRexStandardMaterial(mat rexfile.Material) *material.Standard {
+func NewRexStandardMaterial(mat rexfile.Material) *RexStandardMaterial {
 
 	phong := material.NewStandard(&math32.Color{
 		R: mat.KdRgb.X(),
@@ -26,5 +35,8 @@ func NewRexStandardMaterial(mat rexfile.Material) *material.Standard {
 	phong.SetSide(material.SideFront)
 	phong.SetOpacity(mat.Alpha)
 
-	return phong
+	return &RexStandardMaterial{
+		Standard: phong,
+		Data:     mat,
+	}
 }
@@ -12,7 +12,7 @@ type CameraPathMover struct {
 	*core.Node
 
 	cam     *camera.Camera // Controlled camera
-	up      math32.Vector3 // The orbit axis (Y+)
+	up      math32.Vector3 // The up axis, the heading is rotated around it (Z+)
 	enabled bool
 
 	location     *math32.Vector3
@@ -43,7 +43,7 @@ func NewCameraPathMover(path []*math32.Vector3, cam *camera.Camera) *CameraPathM
 		acceleration: math32.NewVec3(),
 		maxSpeed:     10.0,
 		maxForce:     1.0, // for direction changes
-		up:           *math32.NewVector3(0, 1, 0),
+		up:           *math32.NewVector3(0, 0, 1),
 		enabled:      false,
 		pathId:       0,
 	}
@@ -51,6 +51,12 @@ func NewCameraPathMover(path []*math32.Vector3, cam *camera.Camera) *CameraPathM
 	return cpc
 }
 
+// SetUpAxis sets the axis pointing upward, the default is Z+. Use Y+ for
+// scenes loaded with a conversion to a y-up coordinate system.
+func (c *CameraPathMover) SetUpAxis(up *math32.Vector3) {
+	c.up = *up.Clone().Normalize()
+}
+
 func (c *CameraPathMover) CurrentLocation() *math32.Vector3 {
 	return c.location
 }
@@ -120,11 +126,16 @@ func (c *CameraPathMover) Update(deltaTime time.Duration) {
 	c.SetPositionVec(c.location)
 	c.acceleration.MultiplyScalar(0.0)
 
-	c.cam.SetPosition(c.location.X, c.location.Y+1, c.location.Z)
+	// the camera is one unit above the path
+	c.cam.SetPositionVec(c.location.Clone().Add(&c.up))
 	// c.cam.LookAt(c.path[c.pathId].Clone().SetY(0), &c.up)
 }
 
 func (c *CameraPathMover) rotateVelocityDirection() {
-	theta := math32.Atan2(c.velocity.Y, c.velocity.X)
-	c.SetRotationZ(theta)
+	// heading around the up axis, measured from X+
+	x := math32.NewVector3(1, 0, 0)
+	theta := math32.Atan2(x.Clone().Cross(c.velocity).Dot(&c.up), x.Dot(c.velocity))
+	var q math32.Quaternion
+	q.SetFromAxisAngle(&c.up, theta)
+	c.SetQuaternionQuat(&q)
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/breiting/g3next/loader/rex"
 	"github.com/breiting/g3next/mover"
 	"github.com/g3n/engine/camera"
 	"github.com/g3n/engine/core"
@@ -38,6 +39,7 @@ type App struct {
 	cameramover *mover.CameraPathMover
 	frameRater  *util.FrameRater
 	rayCaster   *collision.Raycaster
+	queue       *rex.Queue // functions of background loaders to run on the render loop
 }
 
 // NewApp creates a new app
@@ -62,6 +64,7 @@ func NewApp(width, height int, title string) *App {
 	fmt.Println("OpenGL version:", glVersion)
 	a.Gls().SetCheckErrors(true)
 	a.frameRater = util.NewFrameRater(targetFPS)
+	a.queue = rex.NewQueue()
 
 	a.setupScene()
 	a.setupLights()
@@ -94,6 +97,9 @@ func (a *App) onMouseMove(evname string, ev interface{}) {
 		return
 	}
 	fmt.Printf("World position: %v\n", intersects[0].Point)
+	if md, ok := rex.MetadataOf(intersects[0].Object); ok {
+		fmt.Println(md)
+	}
 }
 
 func (a *App) onKey(evname string, ev interface{}) {
@@ -172,6 +178,8 @@ func (a *App) render(deltaTime time.Duration) {
 
 	a.frameRater.Start()
 
+	a.queue.Drain()
+
 	a.Gls().Clear(gls.COLOR_BUFFER_BIT | gls.DEPTH_BUFFER_BIT | gls.STENCIL_BUFFER_BIT)
 
 	camPos := a.camera.Position()
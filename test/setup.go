@@ -1,9 +1,8 @@
 package main
 
 import (
-	"bytes"
-	"io/ioutil"
-	"math"
+	"context"
+	"fmt"
 	"net/http"
 	"os"
 
@@ -25,6 +24,9 @@ const (
 	sampleRexFileUrl = "https://github.com/roboticeyes/gorexfile/raw/master/examples/models/capsule/capsule.rex"
 )
 
+// yUp converts REX data into the y-up world of the camera
+var yUp = rex.CoordinateConversion{From: rex.ZUpRightHanded, To: rex.YUpRightHanded}
+
 func createImage() *core.Node {
 	f, err := os.Open("data/gopher.png")
 	if err != nil {
@@ -74,35 +76,37 @@ func createRexTrackFromFile() *core.Node {
 	defer reader.Close()
 
 	decoder := rex.NewDecoderReader(reader)
+	decoder.SetOptions(rex.LoadOptions{Coordinates: yUp})
 	rexNode, err := decoder.NewGroup("rex")
 	if err != nil {
 		panic(err)
 	}
-	rexNode.SetRotationX(math.Pi / 2.0)
 	return rexNode
 }
 
-func createRexFile() *core.Node {
+func (a *App) createRexFile() *core.Node {
 	resp, err := http.Get(sampleRexFileUrl)
 
 	if err != nil {
 		panic(err)
 	}
-	defer resp.Body.Close()
-	body, _ := ioutil.ReadAll(resp.Body)
-	reader := bytes.NewReader(body)
 
 	// TODO for local test only
 	// reader, _ := os.Open("testfile.rex")
 	// defer reader.Close()
 
-	decoder := rex.NewDecoderReader(reader)
-	rexNode, err := decoder.NewGroup("rex")
-	if err != nil {
-		panic(err)
-	}
+	decoder := rex.NewDecoderReader(resp.Body)
+	decoder.SetOptions(rex.LoadOptions{Coordinates: yUp})
+	load := decoder.NewGroupAsync(context.Background(), "rex", a.queue, nil)
+	go func() {
+		if err := load.Err(); err != nil {
+			fmt.Println(err)
+		}
+		resp.Body.Close()
+	}()
+
+	rexNode := load.Group()
 	rexNode.SetScale(0.5, 0.5, 0.5)
-	rexNode.SetRotationX(math.Pi / 2.0)
 	return rexNode
 }
 
@@ -119,14 +123,13 @@ func (a *App) setupScene() {
 	a.root = core.NewNode()
 	a.scene = core.NewNode()
 
-	a.scene.SetRotationX(-math.Pi / 2.0)
 	// a.root.Add(helper.NewGrid(gridSize, 1, &math32.Color{R: 0.4, G: 0.4, B: 0.4}))
 	// a.scene.Add(helper.NewAxes(1))
 	a.root.Add(a.scene)
 
 	// begin add entities
 	// a.scene.Add(createImage())
-	a.scene.Add(createRexFile())
+	a.scene.Add(a.createRexFile())
 	// a.scene.Add(createRexTrackFromFile())
 	// a.scene.Add(createTerrain())
 	// a.scene.Add(createRexTrack())
@@ -160,9 +163,11 @@ func (a *App) setupScene() {
 
 	var path []*math32.Vector3
 	for _, v := range rex.Tracks[0].Points {
-		path = append(path, math32.NewVector3(v.Point.X(), v.Point.Y(), v.Point.Z()))
+		p := yUp.Apply(v.Point)
+		path = append(path, math32.NewVector3(p.X(), p.Y(), p.Z()))
 	}
 
 	a.cameramover = mover.NewCameraPathMover(path, a.camera)
+	a.cameramover.SetUpAxis(math32.NewVector3(0, 1, 0))
 	a.root.Add(a.cameramover)
 }